@@ -4,6 +4,9 @@ import './App.css';
 import Home from './pages/Home';
 import Login from './components/Login';
 import Signup from './components/Signup';
+import ForgotPassword from './components/ForgotPassword';
+import ResetPassword from './components/ResetPassword';
+import SsoCallback from './components/SsoCallback';
 
 const App = () => {
     const token = localStorage.getItem('token');
@@ -14,6 +17,9 @@ const App = () => {
                 <Route path="/" element={token ? <Home /> : <Navigate to="/login" />} />
                 <Route path="/login" element={!token ? <Login /> : <Navigate to="/" />} />
                 <Route path="/signup" element={!token ? <Signup /> : <Navigate to="/" />} />
+                <Route path="/forgot-password" element={<ForgotPassword />} />
+                <Route path="/reset-password" element={<ResetPassword />} />
+                <Route path="/sso-callback" element={<SsoCallback />} />
             </Routes>
         </Router>
     );
@@ -0,0 +1,74 @@
+import axios from 'axios';
+
+const API_URL = 'http://localhost:8000';
+
+export const saveTokens = (data) => {
+  localStorage.setItem('token', data.token);
+  localStorage.setItem('refreshToken', data.refreshToken);
+};
+
+export const clearTokens = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+};
+
+// Одновременные запросы с истёкшим токеном ждут одного обновления:
+// refresh-токен одноразовый, повторный обмен завершил бы сессию
+let refreshing = null;
+
+export const refreshTokens = () => {
+  if (!refreshing) {
+    refreshing = fetch(`${API_URL}/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ refreshToken: localStorage.getItem('refreshToken') }),
+    })
+      .then(async (response) => {
+        if (!response.ok) {
+          clearTokens();
+          window.location.assign('/login');
+          throw new Error('Session expired');
+        }
+        const data = await response.json();
+        saveTokens(data);
+        return data.token;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// authFetch — fetch с заголовком Authorization, который обновляет токен при 401
+export const authFetch = async (url, options = {}) => {
+  const withToken = (token) => ({
+    ...options,
+    headers: { ...options.headers, Authorization: `Bearer ${token}` },
+  });
+  const response = await fetch(url, withToken(localStorage.getItem('token')));
+  if (response.status !== 401 || !localStorage.getItem('refreshToken')) {
+    return response;
+  }
+  return fetch(url, withToken(await refreshTokens()));
+};
+
+export const installAuthRefresh = () => {
+  axios.interceptors.response.use(undefined, async (error) => {
+    const { config, response } = error;
+    if (!response || response.status !== 401 || config.retried || !localStorage.getItem('refreshToken')) {
+      throw error;
+    }
+    const token = await refreshTokens();
+    return axios({ ...config, retried: true, headers: { ...config.headers, Authorization: `Bearer ${token}` } });
+  });
+};
+
+export const logout = async (allDevices = false) => {
+  try {
+    await authFetch(`${API_URL}/${allDevices ? 'logout-all' : 'logout'}`, { method: 'POST' });
+  } catch (error) {
+    console.error('Error logging out:', error);
+  }
+  clearTokens();
+};
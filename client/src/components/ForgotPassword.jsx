@@ -0,0 +1,60 @@
+import React, { useState } from "react";
+import { Link } from "react-router-dom";
+import "./Auth.css";
+
+const ForgotPassword = () => {
+    const [email, setEmail] = useState("");
+    const [message, setMessage] = useState("");
+    const [error, setError] = useState("");
+
+    const handleSubmit = async (e) => {
+        e.preventDefault();
+        try {
+            const response = await fetch("http://localhost:8000/password/forgot", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify({ email }),
+            });
+            const data = await response.json();
+            if (response.ok) {
+                setError("");
+                setMessage("Check your email for a password reset link.");
+            } else {
+                setError(data.error);
+            }
+        } catch (error) {
+            console.error("Error:", error);
+        }
+    };
+
+    return (
+        <div className="auth-container">
+            <h1>Forgot password</h1>
+            <form onSubmit={handleSubmit}>
+                <div className="form-group last">
+                    <label htmlFor="email">Email:</label>
+                    <input
+                        type="email"
+                        id="email"
+                        name="email"
+                        value={email}
+                        onChange={(e) => setEmail(e.target.value)}
+                        required
+                    />
+                </div>
+                <button className="btn-auth" type="submit">
+                    Send reset link
+                </button>
+            </form>
+            {message && <p>{message}</p>}
+            {error && <p className="error-message">{error}</p>}
+            <p>
+                Remembered it? <Link to="/login">Log in</Link>
+            </p>
+        </div>
+    );
+};
+
+export default ForgotPassword;
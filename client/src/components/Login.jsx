@@ -1,13 +1,26 @@
-import React, { useState } from "react";
-import { Link, useNavigate } from "react-router-dom";
+import React, { useEffect, useState } from "react";
+import { Link, useLocation, useNavigate } from "react-router-dom";
 import "./Auth.css";
+import { saveTokens } from "../auth";
 
 const Login = () => {
     const [email, setEmail] = useState("");
     const [password, setPassword] = useState("");
     const [error, setError] = useState("");
+    const location = useLocation();
+    // После входа через SSO второй шаг 2FA приходит со страницы /sso-callback
+    const [challengeToken, setChallengeToken] = useState(location.state?.challengeToken || "");
+    const [code, setCode] = useState("");
+    const [ssoEnabled, setSsoEnabled] = useState(false);
     const navigate  = useNavigate();
 
+    useEffect(() => {
+        fetch("http://localhost:8000/auth/oidc")
+            .then((response) => response.json())
+            .then((data) => setSsoEnabled(data.enabled))
+            .catch(() => setSsoEnabled(false));
+    }, []);
+
     const handleLogin = async (e) => {
         e.preventDefault();
         try {
@@ -19,8 +32,11 @@ const Login = () => {
                 body: JSON.stringify({ email, password }),
             });
             const data = await response.json();
-            if (response.ok) {
-                localStorage.setItem("token", data.token);
+            if (response.ok && data.twoFactorRequired) {
+                setError("");
+                setChallengeToken(data.challengeToken);
+            } else if (response.ok) {
+                saveTokens(data);
                 window.history.go("/")
             } else {
                 setError("Invalid email or password.");
@@ -30,6 +46,59 @@ const Login = () => {
         }
     };
 
+    // Код из приложения — 6 цифр, всё остальное считается кодом восстановления
+    const handleTwoFactor = async (e) => {
+        e.preventDefault();
+        const trimmed = code.trim();
+        const body = /^\d{6}$/.test(trimmed)
+            ? { challengeToken, code: trimmed }
+            : { challengeToken, recoveryCode: trimmed };
+        try {
+            const response = await fetch("http://localhost:8000/login/2fa", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify(body),
+            });
+            const data = await response.json();
+            if (response.ok) {
+                saveTokens(data);
+                window.history.go("/")
+            } else {
+                setError(data.error);
+            }
+        } catch (error) {
+            console.error("Error:", error);
+        }
+    };
+
+    if (challengeToken) {
+        return (
+            <div className="auth-container">
+                <h1>Two-factor authentication</h1>
+                <form onSubmit={handleTwoFactor}>
+                    <div className="form-group last">
+                        <label htmlFor="code">Code from your authenticator app or a recovery code:</label>
+                        <input
+                            type="text"
+                            id="code"
+                            name="code"
+                            autoComplete="one-time-code"
+                            value={code}
+                            onChange={(e) => setCode(e.target.value)}
+                            required
+                        />
+                    </div>
+                    <button className="btn-auth" type="submit">
+                        Verify
+                    </button>
+                </form>
+                {error && <p className="error-message">{error}</p>}
+            </div>
+        );
+    }
+
     return (
         <div className="auth-container">
             <h1>Log in</h1>
@@ -60,10 +129,18 @@ const Login = () => {
                     Log in
                 </button>
             </form>
+            {ssoEnabled && (
+                <button className="btn-auth" type="button" onClick={() => window.location.assign("http://localhost:8000/auth/oidc/login")}>
+                    Log in with SSO
+                </button>
+            )}
             {error && <p className="error-message">{error}</p>}
             <p>
                 Don't have an account? <Link to="/signup">Sign up</Link>
             </p>
+            <p>
+                <Link to="/forgot-password">Forgot password?</Link>
+            </p>
         </div>
     );
 };
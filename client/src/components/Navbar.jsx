@@ -1,5 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
+import { authFetch, logout } from '../auth';
 
 const Navbar = () => {
     const navigate = useNavigate();
@@ -12,17 +13,13 @@ const Navbar = () => {
     useEffect(() => {
         const token = localStorage.getItem('token');
         if (token) {
-            fetchUserInfo(token);
+            fetchUserInfo();
         }
     }, []);
 
-    const fetchUserInfo = async (token) => {
+    const fetchUserInfo = async () => {
         try {
-            const response = await fetch("http://localhost:8000/api/user-info", {
-                headers: {
-                    Authorization: `Bearer ${token}`
-                }
-            });
+            const response = await authFetch("http://localhost:8000/api/user-info");
             const data = await response.json();
             setUserInfo(data);
         } catch (error) {
@@ -30,20 +27,19 @@ const Navbar = () => {
         }
     };
 
-    const handleLogout = () => {
-        localStorage.removeItem('token');
+    const handleLogout = async () => {
+        await logout();
+        window.history.go("/login")
+    };
+
+    const handleLogoutAll = async () => {
+        await logout(true);
         window.history.go("/login")
     };
 
     const handleResendActivation = async () => {
         try {
-            const token = localStorage.getItem('token');
-            const response = await fetch("http://localhost:8000/resend-activation-link", {
-                method: "GET",
-                headers: {
-                    Authorization: `Bearer ${token}`
-                }
-            });
+            const response = await authFetch("http://localhost:8000/resend-activation-link");
             handleLogout();
             // Ваша логика обработки ответа здесь
         } catch (error) {
@@ -53,12 +49,7 @@ const Navbar = () => {
 
     const openModal = async () => {
         try {
-            const token = localStorage.getItem('token');
-            const response = await fetch("http://localhost:8000/api/admin/users", {
-                headers: {
-                    Authorization: `Bearer ${token}`
-                }
-            });
+            const response = await authFetch("http://localhost:8000/api/admin/users");
             const data = await response.json();
             setUsers(data);
             setShowModal(true);
@@ -69,11 +60,9 @@ const Navbar = () => {
 
     const handleSendMailing = async () => {
         try {
-            const token = localStorage.getItem('token');
-            const response = await fetch("http://localhost:8000/api/admin/mailing", {
+            const response = await authFetch("http://localhost:8000/api/admin/mailing", {
                 method: "POST",
                 headers: {
-                    Authorization: `Bearer ${token}`,
                     "Content-Type": "application/json"
                 },
                 body: JSON.stringify({ subject, body })
@@ -98,6 +87,7 @@ const Navbar = () => {
                 </div>
                 : ""}
             <button onClick={handleLogout}>Logout</button>
+            <button onClick={handleLogoutAll}>Выйти на всех устройствах</button>
 
             {showModal && (
                 <div className="modal">
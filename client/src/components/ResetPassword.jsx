@@ -0,0 +1,75 @@
+import React, { useState } from "react";
+import { Link, useNavigate, useSearchParams } from "react-router-dom";
+import "./Auth.css";
+
+const ResetPassword = () => {
+    const [searchParams] = useSearchParams();
+    const [password, setPassword] = useState("");
+    const [confirmPassword, setConfirmPassword] = useState("");
+    const [error, setError] = useState("");
+    const navigate = useNavigate();
+
+    const handleSubmit = async (e) => {
+        e.preventDefault();
+        if (password !== confirmPassword) {
+            setError("Passwords do not match");
+            return;
+        }
+        try {
+            const response = await fetch("http://localhost:8000/password/reset", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify({ token: searchParams.get("token"), password }),
+            });
+            const data = await response.json();
+            if (response.ok) {
+                navigate("/login");
+            } else {
+                setError(data.error);
+            }
+        } catch (error) {
+            console.error("Error:", error);
+        }
+    };
+
+    return (
+        <div className="auth-container">
+            <h1>Reset password</h1>
+            <form onSubmit={handleSubmit}>
+                <div className="form-group">
+                    <label htmlFor="password">New password:</label>
+                    <input
+                        type="password"
+                        id="password"
+                        name="password"
+                        value={password}
+                        onChange={(e) => setPassword(e.target.value)}
+                        required
+                    />
+                </div>
+                <div className="form-group last">
+                    <label htmlFor="confirmPassword">Confirm password:</label>
+                    <input
+                        type="password"
+                        id="confirmPassword"
+                        name="confirmPassword"
+                        value={confirmPassword}
+                        onChange={(e) => setConfirmPassword(e.target.value)}
+                        required
+                    />
+                </div>
+                <button className="btn-auth" type="submit">
+                    Set new password
+                </button>
+            </form>
+            {error && <p className="error-message">{error}</p>}
+            <p>
+                <Link to="/login">Back to log in</Link>
+            </p>
+        </div>
+    );
+};
+
+export default ResetPassword;
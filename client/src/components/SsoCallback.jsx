@@ -0,0 +1,36 @@
+import React, { useEffect, useState } from "react";
+import { Link, useNavigate } from "react-router-dom";
+import "./Auth.css";
+import { saveTokens } from "../auth";
+
+// Сервер возвращает результат входа через SSO во фрагменте адреса
+const SsoCallback = () => {
+    const [error, setError] = useState("");
+    const navigate = useNavigate();
+
+    useEffect(() => {
+        const params = new URLSearchParams(window.location.hash.slice(1));
+        // Токены не должны оставаться в истории браузера
+        window.history.replaceState(null, "", window.location.pathname);
+        if (params.get("token")) {
+            saveTokens({ token: params.get("token"), refreshToken: params.get("refreshToken") });
+            window.location.assign("/");
+        } else if (params.get("challengeToken")) {
+            navigate("/login", { state: { challengeToken: params.get("challengeToken") } });
+        } else {
+            setError(params.get("error") || "Single sign-on failed.");
+        }
+    }, [navigate]);
+
+    return (
+        <div className="auth-container">
+            <h1>Single sign-on</h1>
+            {error ? <p className="error-message">{error}</p> : <p>Signing in...</p>}
+            <p>
+                <Link to="/login">Back to log in</Link>
+            </p>
+        </div>
+    );
+};
+
+export default SsoCallback;
@@ -50,6 +50,18 @@ const Home = () => {
 
   const fetchTasks = async () => {
     try {
+      if (filters.star) {
+        // Избранное — встроенный список сервера
+        const response = await axios.get('http://localhost:8000/api/lists/starred', {
+          headers: {
+            Authorization: `Bearer ${getToken()}`,
+          },
+        });
+        setTasks(response.data.groups.flatMap((group) => group.tasks));
+        setPagination((prev) => ({ ...prev, total: response.data.total }));
+        return;
+      }
+
       const response = await axios.get('http://localhost:8000/api/tasks', {
         params: {
           page: pagination.page,
@@ -62,8 +74,8 @@ const Home = () => {
         },
       });
 
-      setTasks(response.data);
-      setPagination((prev) => ({ ...prev, total: response.headers['x-total-count'] }));
+      setTasks(response.data.items);
+      setPagination((prev) => ({ ...prev, total: response.data.total }));
     } catch (error) {
       console.error('Ошибка получения задач:', error);
     }
@@ -108,12 +120,20 @@ const Home = () => {
         headers: {
           Authorization: `Bearer ${getToken()}`,
           'Content-Type': 'application/json',
+          'If-Match': `"${editingTask.version}"`,
         },
       });
       const updatedTasks = tasks.map((task) => (task.ID === editingTask.ID ? response.data : task));
       setTasks(updatedTasks);
       setEditingTask(null);
     } catch (error) {
+      if (error.response && error.response.status === 412) {
+        // Задачу изменили в другой вкладке — показываем актуальную версию
+        alert('Задача была изменена в другом окне. Список обновлён, повторите изменения.');
+        setEditingTask(null);
+        fetchTasks();
+        return;
+      }
       console.error('Ошибка обновления задачи:', error);
     }
   };
@@ -152,11 +172,11 @@ const Home = () => {
           'Content-Type': 'application/json', // Указание типа содержимого для запроса
         },
       });
-      const { haveStar, lastUpdated } = response.data;
+      const { haveStar, priority, lastUpdated, version } = response.data;
 
       setTasks((prevTasks) =>
           prevTasks.map((task) =>
-              task.ID === taskId ? { ...task, star: haveStar, lastUpdated } : task
+              task.ID === taskId ? { ...task, star: haveStar, priority, lastUpdated, version } : task
           )
       );
     } catch (error) {
@@ -245,6 +265,8 @@ const Home = () => {
               <option value='name'>Name</option>
               <option value='details'>Details</option>
               <option value='lastUpdated'>Updated time</option>
+              <option value='position'>Manual</option>
+              <option value='priority'>Priority</option>
             </select>
             </div>
             <select className='sort-order' name='sortOrder' value={filters.sortOrder} onChange={(e) => handleSortOrderChange(e.target.value)}>
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// taskScope ограничивает запрос задачами, к которым у пользователя есть доступ.
+// Пока это только собственные задачи; доступ соавторов добавляется здесь же,
+// чтобы все обработчики задач получили его одновременно.
+func taskScope(userId uint) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("tasks.user_id = ?", userId)
+	}
+}
+
+// findUserTask загружает задачу из параметра маршрута :id от имени вызывающего.
+// Чужие задачи отдаются как 404, точно так же как отсутствующие, чтобы по
+// ответу нельзя было перебирать идентификаторы.
+func findUserTask(c *gin.Context, action string, tx *gorm.DB) (Task, *Principal, bool) {
+	var task Task
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return task, nil, false
+	}
+
+	taskID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error parsing task ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат идентификатора задачи"})
+		return task, nil, false
+	}
+
+	if err := tx.Scopes(taskScope(principal.UserId)).First(&task, "tasks.id = ?", taskID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения задачи"})
+		}
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"userId": principal.UserId,
+			"taskID": taskID,
+			"error":  err.Error(),
+		}).Error("Error retrieving task")
+		return task, nil, false
+	}
+	return task, principal, true
+}
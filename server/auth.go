@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+)
+
+const principalKey = "principal"
+
+var (
+	errMissingAuthorization   = errors.New("Missing Authorization header")
+	errMalformedAuthorization = errors.New("Malformed Authorization header")
+	errUnsupportedScheme      = errors.New("Unsupported authorization scheme")
+	errInvalidToken           = errors.New("Invalid token")
+)
+
+// Principal — аутентифицированный автор запроса. AuthMiddleware кладёт его
+// в контекст gin, обработчики достают через currentPrincipal.
+type Principal struct {
+	UserId      uint
+	Username    string
+	Email       string
+	IsActivated bool
+	Role        string
+	// SessionID — сессия, к которой привязан access-токен
+	SessionID uuid.UUID
+	// Scopes — права персонального токена; nil для входа через сессию
+	Scopes []string
+	// TokenID — персональный токен, которым выполнен запрос
+	TokenID uuid.UUID
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.Role == "ADMIN"
+}
+
+// authenticator проверяет учётные данные одной схемы заголовка Authorization.
+// Новые способы аутентификации добавляются в authenticators.
+type authenticator func(credentials string) (*Principal, error)
+
+var authenticators = map[string]authenticator{
+	"bearer": authenticateBearer,
+	"token":  authenticateAPIToken,
+}
+
+// parseAuthorization разбирает заголовок Authorization на схему в нижнем
+// регистре и учётные данные.
+func parseAuthorization(header string) (string, string, error) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return "", "", errMissingAuthorization
+	}
+	scheme, credentials, found := strings.Cut(header, " ")
+	credentials = strings.TrimSpace(credentials)
+	if !found || credentials == "" {
+		return "", "", errMalformedAuthorization
+	}
+	return strings.ToLower(scheme), credentials, nil
+}
+
+func authenticateJWT(tokenString string) (*Principal, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errInvalidToken
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errInvalidToken
+	}
+	// Токены без сессии выданы до появления отзыва и больше не принимаются
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	if err := checkSession(sessionID, claims.UserId); err != nil {
+		if errors.Is(err, errSessionRevoked) {
+			return nil, err
+		}
+		return nil, errInvalidToken
+	}
+	return &Principal{
+		UserId:      claims.UserId,
+		Username:    claims.Username,
+		Email:       claims.Email,
+		IsActivated: claims.IsActivated,
+		Role:        claims.ROLE,
+		SessionID:   sessionID,
+	}, nil
+}
+
+func authenticate(c *gin.Context) (*Principal, error) {
+	scheme, credentials, err := parseAuthorization(c.GetHeader("Authorization"))
+	if err != nil {
+		return nil, err
+	}
+	authenticate, ok := authenticators[scheme]
+	if !ok {
+		return nil, errUnsupportedScheme
+	}
+	return authenticate(credentials)
+}
+
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := authenticate(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err := authorizeScope(c, principal); err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := currentPrincipal(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+
+		// Проверка роли пользователя
+		if !principal.IsAdmin() {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// currentPrincipal возвращает пользователя, установленного AuthMiddleware.
+// Если обработчик подключён без middleware, отвечает 401.
+func currentPrincipal(c *gin.Context) (*Principal, bool) {
+	if value, exists := c.Get(principalKey); exists {
+		if principal, ok := value.(*Principal); ok {
+			return principal, true
+		}
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": errMissingAuthorization.Error()})
+	return nil, false
+}
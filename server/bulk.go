@@ -0,0 +1,360 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+const maxBulkOperations = 500
+
+var bulkOperationNames = []string{"complete", "create", "delete", "move", "star", "tag", "untag", "update"}
+
+// bulkOperation — одна операция пакета. Набор полей зависит от op:
+//
+//	create   task
+//	update   id, patch (JSON Merge Patch, как в PATCH /tasks/:id)
+//	delete   id, children (cascade | promote)
+//	star     id, value (без value звезда переключается)
+//	complete id, value (false снимает отметку о выполнении)
+//	move     id, projectId (null — во «Входящие»)
+//	tag      id, tagId
+//	untag    id, tagId
+//
+// version задаёт ожидаемую версию задачи, как заголовок If-Match.
+type bulkOperation struct {
+	Op        string                 `json:"op"`
+	ID        *uuid.UUID             `json:"id"`
+	Version   *int                   `json:"version"`
+	Task      *Task                  `json:"task"`
+	Patch     map[string]interface{} `json:"patch"`
+	Value     *bool                  `json:"value"`
+	ProjectID *uuid.UUID             `json:"projectId"`
+	TagID     *uuid.UUID             `json:"tagId"`
+	Children  string                 `json:"children"`
+}
+
+type bulkRequest struct {
+	Atomic     *bool           `json:"atomic"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+type BulkResult struct {
+	Index   int        `json:"index"`
+	Op      string     `json:"op"`
+	Status  int        `json:"status"`
+	ID      *uuid.UUID `json:"id,omitempty"`
+	Task    *Task      `json:"task,omitempty"`
+	Error   string     `json:"error,omitempty"`
+	Allowed []string   `json:"allowed,omitempty"`
+}
+
+type BulkResponse struct {
+	Atomic    bool         `json:"atomic"`
+	Committed bool         `json:"committed"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// errBulkAborted откатывает атомарный пакет после первой неудачной операции
+var errBulkAborted = errors.New("bulk operation aborted")
+
+// loadBulkTask находит задачу операции и проверяет ожидаемую версию
+func loadBulkTask(tx *gorm.DB, userId uint, op *bulkOperation) (Task, error) {
+	var task Task
+	if op.ID == nil {
+		return task, &requestError{status: http.StatusBadRequest, message: "Не указан id задачи"}
+	}
+	if err := tx.Scopes(taskScope(userId)).First(&task, "tasks.id = ?", *op.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return task, &requestError{status: http.StatusNotFound, message: "Задача не найдена"}
+		}
+		return task, err
+	}
+	if op.Version != nil && *op.Version != task.Version {
+		return task, errTaskVersionConflict
+	}
+	return task, nil
+}
+
+// runBulkOperation выполняет одну операцию внутри транзакции пакета и
+// возвращает код результата и итоговое состояние задачи.
+func runBulkOperation(tx *gorm.DB, userId uint, op *bulkOperation) (int, *Task, error) {
+	if op.Op == "create" {
+		if op.Task == nil {
+			return 0, nil, &requestError{status: http.StatusBadRequest, message: "Не указана задача"}
+		}
+		task := *op.Task
+		if err := prepareNewTask(tx, &task, userId); err != nil {
+			return 0, nil, err
+		}
+		if err := createTask(tx, &task, userId); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusCreated, &task, nil
+	}
+
+	known := false
+	for _, name := range bulkOperationNames {
+		known = known || name == op.Op
+	}
+	if !known {
+		return 0, nil, &queryError{message: fmt.Sprintf("Неизвестная операция %q", op.Op), allowed: bulkOperationNames}
+	}
+
+	task, err := loadBulkTask(tx, userId, op)
+	if err != nil {
+		return 0, nil, err
+	}
+	before := snapshotOf(&task)
+
+	switch op.Op {
+	case "update":
+		if op.Patch == nil {
+			return 0, nil, &requestError{status: http.StatusBadRequest, message: "Не указан patch"}
+		}
+		wasCompleted := task.Completed
+		if err := applyTaskPatch(&task, op.Patch); err != nil {
+			return 0, nil, err
+		}
+		if err := prepareTaskUpdate(&task, before); err != nil {
+			return 0, nil, err
+		}
+		err = updateTask(tx, &task, before, wasCompleted, userId, "patch")
+
+	case "delete":
+		children := op.Children
+		if children == "" {
+			children = "cascade"
+		}
+		if children != "cascade" && children != "promote" {
+			return 0, nil, &requestError{status: http.StatusBadRequest, message: "Неверное значение children: допустимы cascade, promote"}
+		}
+		return http.StatusOK, nil, deleteTaskTree(tx, &task, children)
+
+	case "star":
+		if op.Value == nil || *op.Value != task.HaveStar {
+			task.ToggleHaveStar()
+		}
+		if err = saveTaskVersioned(tx, &task); err == nil {
+			err = recordRevision(tx, &task, &before, userId, "star", nil)
+		}
+
+	case "complete":
+		if op.Value != nil && !*op.Value {
+			task.Reopen()
+			if err = saveTaskVersioned(tx, &task); err == nil {
+				err = recordRevision(tx, &task, &before, userId, "reopen", nil)
+			}
+			break
+		}
+		wasCompleted := task.Completed
+		task.Complete()
+		if err = saveTaskVersioned(tx, &task); err == nil {
+			err = recordRevision(tx, &task, &before, userId, "complete", nil)
+		}
+		if err == nil && !wasCompleted {
+			_, err = spawnNextOccurrence(tx, &task)
+		}
+
+	case "move":
+		err = moveTaskToProject(tx, &task, before, op.ProjectID, userId)
+
+	case "tag", "untag":
+		if op.TagID == nil {
+			return 0, nil, &requestError{status: http.StatusBadRequest, message: "Не указан tagId"}
+		}
+		var tag Tag
+		if err := tx.First(&tag, "id = ? AND user_id = ?", *op.TagID, userId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, nil, &requestError{status: http.StatusNotFound, message: "Тег не найден"}
+			}
+			return 0, nil, err
+		}
+		association := tx.Model(&task).Association("Tags")
+		if op.Op == "tag" {
+			err = association.Append(&tag)
+		} else {
+			err = association.Delete(&tag)
+		}
+		if err == nil {
+			err = tx.Model(&task).Update("lastupdated", time.Now()).Error
+		}
+		if err == nil {
+			err = tx.Preload("Tags").First(&task, "id = ?", task.ID).Error
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, &task, nil
+}
+
+// moveTaskToProject переносит корневую задачу вместе с подзадачами в другой проект
+func moveTaskToProject(tx *gorm.DB, task *Task, before TaskSnapshot, projectID *uuid.UUID, userId uint) error {
+	if task.ParentID != nil {
+		return &requestError{status: http.StatusBadRequest, message: "Подзадача всегда находится в проекте родителя"}
+	}
+	if projectID != nil && !projectBelongsTo(*projectID, userId) {
+		return &requestError{status: http.StatusBadRequest, message: "Проект не найден"}
+	}
+	position, err := appendPosition(tx, taskList{UserId: task.UserId, ProjectID: projectID})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	result := tx.Model(&Task{}).Where("id = ? AND version = ?", task.ID, task.Version).Updates(map[string]interface{}{
+		"project_id":  projectID,
+		"position":    position,
+		"lastupdated": now,
+		"version":     gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTaskVersionConflict
+	}
+	task.ProjectID = projectID
+	task.Position = position
+	task.LastUpdated = now
+	task.Version++
+	if err := recordRevision(tx, task, &before, userId, "move", nil); err != nil {
+		return err
+	}
+	return moveSubtreeToProject(tx, task.ID, projectID, now)
+}
+
+// bulkFailure переводит ошибку операции в результат пакета
+func bulkFailure(result *BulkResult, err error) {
+	var requestErr *requestError
+	var queryErr *queryError
+	switch {
+	case errors.As(err, &requestErr):
+		result.Status, result.Error = requestErr.status, requestErr.message
+	case errors.As(err, &queryErr):
+		result.Status, result.Error, result.Allowed = http.StatusBadRequest, queryErr.message, queryErr.allowed
+	case errors.Is(err, errTaskVersionConflict):
+		result.Status, result.Error = http.StatusPreconditionFailed, "Задача была изменена, обновите её и повторите запрос"
+	default:
+		log.WithFields(logrus.Fields{
+			"action": "bulkTasks",
+			"op":     result.Op,
+			"error":  err.Error(),
+		}).Error("Error executing bulk operation")
+		result.Status, result.Error = http.StatusInternalServerError, "Ошибка выполнения операции"
+	}
+}
+
+// BulkTasks выполняет пакет операций над задачами одним запросом и в одной
+// транзакции. В атомарном режиме (по умолчанию) первая ошибка отменяет весь
+// пакет; с "atomic": false неудачные операции откатываются по отдельности,
+// а остальные сохраняются. Для каждой операции возвращается свой результат.
+func BulkTasks(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var request bulkRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	if len(request.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Пакет не содержит операций"})
+		return
+	}
+	if len(request.Operations) > maxBulkOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Пакет может содержать не более %d операций", maxBulkOperations)})
+		return
+	}
+	atomic := request.Atomic == nil || *request.Atomic
+
+	response := BulkResponse{Atomic: atomic, Results: make([]BulkResult, len(request.Operations))}
+	failedAt := -1
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i := range request.Operations {
+			op := &request.Operations[i]
+			result := &response.Results[i]
+			result.Index, result.Op, result.ID = i, op.Op, op.ID
+
+			// Каждая операция — отдельная точка сохранения, чтобы ошибка
+			// откатывала только её изменения
+			var task *Task
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var err error
+				result.Status, task, err = runBulkOperation(tx, principal.UserId, op)
+				return err
+			})
+			if err != nil {
+				bulkFailure(result, err)
+				if atomic {
+					failedAt = i
+					return errBulkAborted
+				}
+				continue
+			}
+			if task != nil {
+				result.ID, result.Task = &task.ID, task
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBulkAborted) {
+		log.WithFields(logrus.Fields{
+			"action": "bulkTasks",
+			"error":  err.Error(),
+		}).Error("Error committing bulk operations")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка выполнения пакета операций"})
+		return
+	}
+
+	if failedAt >= 0 {
+		// Пакет откатан: ни одна операция не применена
+		for i := range response.Results {
+			result := &response.Results[i]
+			if i == failedAt {
+				continue
+			}
+			result.Index, result.Op = i, request.Operations[i].Op
+			result.ID, result.Task = request.Operations[i].ID, nil
+			result.Status = http.StatusFailedDependency
+			result.Error = fmt.Sprintf("Не выполнена: пакет отменён из-за ошибки в операции %d", failedAt)
+		}
+	}
+	for _, result := range response.Results {
+		if result.Status < http.StatusBadRequest {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	response.Committed = failedAt < 0
+
+	log.WithFields(logrus.Fields{
+		"action":    "bulkTasks",
+		"userId":    principal.UserId,
+		"atomic":    atomic,
+		"committed": response.Committed,
+		"succeeded": response.Succeeded,
+		"failed":    response.Failed,
+	}).Info("Bulk task operations executed")
+
+	status := http.StatusOK
+	if !response.Committed {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, response)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TaskSnapshot — состояние полей задачи, которые попадают в историю
+type TaskSnapshot struct {
+	Name        string     `json:"name"`
+	Details     string     `json:"details"`
+	Star        bool       `json:"star"`
+	Priority    *int       `json:"priority"`
+	ProjectID   *uuid.UUID `json:"projectId"`
+	ParentID    *uuid.UUID `json:"parentId"`
+	DueAt       *time.Time `json:"dueAt"`
+	DueHasTime  bool       `json:"dueHasTime"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completedAt"`
+	Recurrence  string     `json:"recurrence"`
+}
+
+// snapshotFields задаёт порядок полей в диффе
+var snapshotFields = []string{"name", "details", "star", "priority", "projectId", "parentId", "dueAt", "dueHasTime", "completed", "completedAt", "recurrence"}
+
+type FieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+type FieldChanges []FieldChange
+
+// TaskRevision — одна запись истории задачи. Snapshot хранит состояние после изменения.
+type TaskRevision struct {
+	ID           uuid.UUID    `gorm:"primaryKey" json:"id"`
+	TaskID       uuid.UUID    `json:"taskId" gorm:"uniqueIndex:idx_task_revisions_task_revision"`
+	Revision     int          `json:"revision" gorm:"uniqueIndex:idx_task_revisions_task_revision"`
+	UserId       uint         `json:"userId"`
+	Action       string       `json:"action"`
+	RestoredFrom *int         `json:"restoredFrom,omitempty"`
+	Changes      FieldChanges `json:"changes" gorm:"type:text"`
+	Snapshot     TaskSnapshot `json:"snapshot" gorm:"type:text"`
+	CreatedDate  time.Time    `json:"createdDate"`
+}
+
+func scanJSON(value interface{}, target interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, target)
+	case string:
+		return json.Unmarshal([]byte(v), target)
+	case nil:
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into %T", value, target)
+}
+
+func (c FieldChanges) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+func (c *FieldChanges) Scan(value interface{}) error {
+	return scanJSON(value, c)
+}
+
+func (s TaskSnapshot) Value() (driver.Value, error) {
+	data, err := json.Marshal(s)
+	return string(data), err
+}
+
+func (s *TaskSnapshot) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// normalizeTime приводит время к UTC с точностью БД, чтобы перечитанная из базы
+// задача не отличалась от только что сохранённой
+func normalizeTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	normalized := t.UTC().Truncate(time.Microsecond)
+	return &normalized
+}
+
+func snapshotOf(task *Task) TaskSnapshot {
+	return TaskSnapshot{
+		Name:        task.Name,
+		Details:     task.Details,
+		Star:        task.HaveStar,
+		Priority:    task.Priority,
+		ProjectID:   task.ProjectID,
+		ParentID:    task.ParentID,
+		DueAt:       normalizeTime(task.DueAt),
+		DueHasTime:  task.DueHasTime,
+		Completed:   task.Completed,
+		CompletedAt: normalizeTime(task.CompletedAt),
+		Recurrence:  task.Recurrence,
+	}
+}
+
+func diffSnapshots(before, after TaskSnapshot) FieldChanges {
+	var beforeFields, afterFields map[string]json.RawMessage
+	data, _ := json.Marshal(before)
+	json.Unmarshal(data, &beforeFields)
+	data, _ = json.Marshal(after)
+	json.Unmarshal(data, &afterFields)
+
+	changes := FieldChanges{}
+	for _, field := range snapshotFields {
+		if string(beforeFields[field]) != string(afterFields[field]) {
+			changes = append(changes, FieldChange{Field: field, Before: beforeFields[field], After: afterFields[field]})
+		}
+	}
+	return changes
+}
+
+// recordRevision добавляет запись в историю задачи внутри транзакции
+// вызывающего. before — состояние до изменения (nil для новой задачи);
+// изменения, не затронувшие отслеживаемых полей, не записываются.
+func recordRevision(tx *gorm.DB, task *Task, before *TaskSnapshot, userId uint, action string, restoredFrom *int) error {
+	after := snapshotOf(task)
+	var changes FieldChanges
+	if before == nil {
+		changes = diffSnapshots(TaskSnapshot{}, after)
+	} else if changes = diffSnapshots(*before, after); len(changes) == 0 {
+		return nil
+	}
+
+	var last int
+	if err := tx.Model(&TaskRevision{}).Where("task_id = ?", task.ID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	return tx.Create(&TaskRevision{
+		ID:           uuid.New(),
+		TaskID:       task.ID,
+		Revision:     last + 1,
+		UserId:       userId,
+		Action:       action,
+		RestoredFrom: restoredFrom,
+		Changes:      changes,
+		Snapshot:     after,
+		CreatedDate:  time.Now(),
+	}).Error
+}
+
+func GetTaskHistory(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, _, ok := findUserTask(c, "getTaskHistory", db)
+	if !ok {
+		return
+	}
+
+	var revisions []TaskRevision
+	if err := db.Where("task_id = ?", task.ID).Order("revision DESC").Find(&revisions).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "getTaskHistory",
+			"error":  err.Error(),
+		}).Error("Error retrieving task history")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения истории задачи"})
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// RestoreTaskRevision возвращает содержимое задачи к состоянию ревизии :rev.
+// Восстанавливаются название, описание, звезда, приоритет, проект, срок и повторение;
+// родитель и статус выполнения меняются только своими эндпоинтами.
+// Сама операция записывается в историю новой ревизией, поэтому её можно отменить.
+func RestoreTaskRevision(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, principal, ok := findUserTask(c, "restoreTaskRevision", db)
+	if !ok {
+		return
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный номер ревизии"})
+		return
+	}
+
+	var revision TaskRevision
+	if err := db.First(&revision, "task_id = ? AND revision = ?", task.ID, rev).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ревизия не найдена"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ревизии"})
+		}
+		return
+	}
+
+	before := snapshotOf(&task)
+	snapshot := revision.Snapshot
+	task.Name = snapshot.Name
+	task.Details = snapshot.Details
+	task.HaveStar = snapshot.Star
+	task.Priority = snapshot.Priority
+	task.DueAt = snapshot.DueAt
+	task.DueHasTime = snapshot.DueHasTime
+	task.Recurrence = snapshot.Recurrence
+	// Проект мог быть удалён; подзадача остаётся в проекте родителя
+	if task.ParentID == nil && (snapshot.ProjectID == nil || projectBelongsTo(*snapshot.ProjectID, task.UserId)) {
+		task.ProjectID = snapshot.ProjectID
+	}
+	task.LastUpdated = time.Now()
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := saveTaskVersioned(tx, &task); err != nil {
+			return err
+		}
+		if err := rescheduleReminders(tx, &task); err != nil {
+			return err
+		}
+		return recordRevision(tx, &task, &before, principal.UserId, "restore", &revision.Revision)
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondVersionConflict(c, &task, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "restoreTaskRevision",
+			"error":  err.Error(),
+		}).Error("Error restoring task revision")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка восстановления ревизии"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":   "restoreTaskRevision",
+		"taskID":   task.ID,
+		"revision": revision.Revision,
+	}).Info("Task revision restored successfully")
+
+	c.Header("ETag", taskETag(&task))
+	c.JSON(http.StatusOK, task)
+}
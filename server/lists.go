@@ -0,0 +1,160 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxUpcomingDays = 90
+
+// TaskGroup — раздел умного списка: день для «Предстоящих», «overdue» и «today» для «Сегодня»
+type TaskGroup struct {
+	Key   string `json:"key"`
+	Tasks []Task `json:"tasks"`
+}
+
+type TaskList struct {
+	List     string      `json:"list"`
+	TimeZone string      `json:"timeZone"`
+	Total    int         `json:"total"`
+	Groups   []TaskGroup `json:"groups"`
+}
+
+func dayKey(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// groupByDueDay раскладывает задачи по дням срока в часовом поясе пользователя.
+// Задачи должны быть отсортированы по сроку.
+func groupByDueDay(tasks []Task, loc *time.Location) []TaskGroup {
+	var groups []TaskGroup
+	for _, task := range tasks {
+		key := dayKey(*task.DueAt, loc)
+		if len(groups) == 0 || groups[len(groups)-1].Key != key {
+			groups = append(groups, TaskGroup{Key: key, Tasks: []Task{}})
+		}
+		groups[len(groups)-1].Tasks = append(groups[len(groups)-1].Tasks, task)
+	}
+	return groups
+}
+
+// GetSmartList возвращает один из встроенных списков (today, upcoming, overdue,
+// starred, inbox) с открытыми задачами вне архивных проектов. Границы дня
+// считаются в часовом поясе пользователя.
+func GetSmartList(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	list := c.Param("list")
+	loc := userLocation(principal.UserId)
+	now := time.Now()
+	today := startOfDay(now, loc)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	query := (&taskFilter{status: "open"}).apply(db.Model(&Task{}).Scopes(taskScope(principal.UserId)), principal.UserId, now, loc)
+	defaultSort := "dueAt"
+	days := 0
+	switch list {
+	case "today":
+		query = query.Where("due_at IS NOT NULL AND due_at < ?", tomorrow)
+	case "upcoming":
+		days, _ = strconv.Atoi(c.DefaultQuery("days", "7"))
+		if days < 1 || days > maxUpcomingDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное значение days: допустимо от 1 до " + strconv.Itoa(maxUpcomingDays)})
+			return
+		}
+		query = query.Where("due_at >= ? AND due_at < ?", today, today.AddDate(0, 0, days))
+	case "overdue":
+		query = query.Where(overdueCondition, now, today)
+	case "starred":
+		query = query.Where("have_star = ?", true)
+		defaultSort = "dueAt,-lastUpdated"
+	case "inbox":
+		query = query.Where("project_id IS NULL")
+		defaultSort = "createdDate"
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Список не найден", "allowed": []string{"inbox", "overdue", "starred", "today", "upcoming"}})
+		return
+	}
+
+	sort := c.Query("sort")
+	if sort == "" || list == "upcoming" || list == "overdue" {
+		// списки, сгруппированные по дням, всегда идут по сроку
+		sort = defaultSort
+	}
+	orders, err := parseTaskSort(sort, "", "")
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+
+	var tasks []Task
+	if err := orderTasks(query.Preload("Tags"), orders).Find(&tasks).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "getSmartList",
+			"list":   list,
+			"error":  err.Error(),
+		}).Error("Error retrieving smart list")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения задач"})
+		return
+	}
+	for i := range tasks {
+		tasks[i].Overdue = tasks[i].IsOverdue(now, loc)
+	}
+
+	response := TaskList{List: list, TimeZone: loc.String(), Total: len(tasks)}
+	switch list {
+	case "today":
+		overdue := TaskGroup{Key: "overdue", Tasks: []Task{}}
+		dueToday := TaskGroup{Key: "today", Tasks: []Task{}}
+		for _, task := range tasks {
+			if task.Overdue {
+				overdue.Tasks = append(overdue.Tasks, task)
+			} else {
+				dueToday.Tasks = append(dueToday.Tasks, task)
+			}
+		}
+		response.Groups = []TaskGroup{overdue, dueToday}
+	case "upcoming":
+		// Пустые дни тоже возвращаются, чтобы клиент мог показать календарную ленту
+		byDay := map[string][]Task{}
+		for _, group := range groupByDueDay(tasks, loc) {
+			byDay[group.Key] = group.Tasks
+		}
+		for i := 0; i < days; i++ {
+			key := dayKey(today.AddDate(0, 0, i), loc)
+			group := TaskGroup{Key: key, Tasks: byDay[key]}
+			if group.Tasks == nil {
+				group.Tasks = []Task{}
+			}
+			response.Groups = append(response.Groups, group)
+		}
+	case "overdue":
+		response.Groups = groupByDueDay(tasks, loc)
+	default:
+		if tasks == nil {
+			tasks = []Task{}
+		}
+		response.Groups = []TaskGroup{{Key: list, Tasks: tasks}}
+	}
+	if response.Groups == nil {
+		response.Groups = []TaskGroup{}
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "getSmartList",
+		"list":   list,
+		"total":  response.Total,
+	}).Info("Smart list retrieved successfully")
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log = logrus.New()
+	log.SetOutput(io.Discard)
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	limiter = rate.NewLimiter(rate.Inf, 0)
+	jwtSecret = []byte("test-secret")
+	os.Setenv("CLIENT_URL", "http://client.test")
+	os.Exit(m.Run())
+}
+
+var (
+	testDBOnce sync.Once
+	testDBErr  error
+)
+
+// setupTestDB подключает тест к пустой базе Postgres из TEST_DATABASE_DSN.
+// Без этой переменной тесты, которым нужна база, пропускаются.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	testDBOnce.Do(func() {
+		db, testDBErr = gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+		if testDBErr == nil {
+			testDBErr = migrateSchema()
+		}
+	})
+	if testDBErr != nil {
+		t.Fatalf("test database: %v", testDBErr)
+	}
+
+	tables := []string{"task_tags"}
+	for _, model := range append([]interface{}{&Task{}}, schemaModels...) {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, statement.Schema.Table)
+	}
+	if err := db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE").Error; err != nil {
+		t.Fatalf("clean test database: %v", err)
+	}
+}
+
+func createTestUser(t *testing.T, username string) *User {
+	t.Helper()
+	user := User{
+		Username:    username,
+		Email:       username + "@example.com",
+		Password:    "-",
+		IsActivated: true,
+		ROLE:        "USER",
+		TimeZone:    "UTC",
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return &user
+}
+
+func createTestTask(t *testing.T, userId uint, task Task) *Task {
+	t.Helper()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := prepareNewTask(tx, &task, userId); err != nil {
+			return err
+		}
+		return createTask(tx, &task, userId)
+	})
+	if err != nil {
+		t.Fatalf("create task: %v", err)
+	}
+	return &task
+}
+
+// authHeader открывает сессию пользователя и возвращает заголовок с её access-токеном
+func authHeader(t *testing.T, user *User) string {
+	t.Helper()
+	now := time.Now()
+	session := Session{
+		ID:               uuid.New(),
+		UserId:           user.ID,
+		RefreshTokenHash: hashToken(uuid.NewString()),
+		CreatedDate:      now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(time.Hour),
+	}
+	if err := db.Create(&session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	token, err := GenerateToken(user, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func performRequest(handler http.Handler, method, path, body, authorization string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcStateExpiresIn = 10 * time.Minute
+	oidcScopes         = "openid email profile"
+	// oidcKeysRefreshInterval ограничивает повторную загрузку JWKS при неизвестном kid
+	oidcKeysRefreshInterval = time.Minute
+	// oidcStateCookie привязывает state к браузеру, начавшему вход: без него
+	// можно подсунуть жертве callback со своим кодом и незаметно впустить её в свой аккаунт
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/auth/oidc"
+)
+
+var (
+	errOIDCEmailNotVerified = errors.New("identity provider did not confirm the email address")
+	errOIDCNotActivated     = errors.New("account with this email is not activated")
+	errOIDCStateInvalid     = errors.New("invalid or expired login state")
+)
+
+// oidcClient — настроенный провайдер единого входа; nil, если OIDC_ISSUER не задан
+var oidcClient *oidcProvider
+
+// OIDCState хранит параметры начатого входа через провайдера до возврата
+// пользователя на callback. state хранится только в виде хэша.
+type OIDCState struct {
+	ID           uuid.UUID `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex"`
+	Nonce        string
+	CodeVerifier string
+	CreatedDate  time.Time
+	ExpiresAt    time.Time
+}
+
+// UserIdentity связывает учётную запись провайдера (issuer + subject) с пользователем.
+type UserIdentity struct {
+	ID          uuid.UUID `gorm:"primaryKey" json:"id"`
+	UserId      uint      `json:"-" gorm:"index"`
+	Issuer      string    `json:"issuer" gorm:"uniqueIndex:idx_user_identity_subject"`
+	Subject     string    `json:"subject" gorm:"uniqueIndex:idx_user_identity_subject"`
+	Email       string    `json:"email"`
+	CreatedDate time.Time `json:"createdDate"`
+	LastLoginAt time.Time `json:"lastLoginAt"`
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// oidcIdentity — проверенные утверждения из id_token
+type oidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+}
+
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	httpClient   *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*rsa.PublicKey
+	keysFetchedAt time.Time
+}
+
+// loadOIDCProvider читает настройки единого входа из окружения. Без OIDC_ISSUER
+// вход через провайдера выключен.
+func loadOIDCProvider() (*oidcProvider, error) {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil, nil
+	}
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+	}
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = os.Getenv("API_URL") + "/auth/oidc/callback"
+	}
+	if _, err := url.ParseRequestURI(redirectURL); err != nil {
+		return nil, fmt.Errorf("invalid OIDC_REDIRECT_URL %q", redirectURL)
+	}
+	return &oidcProvider{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		redirectURL:  redirectURL,
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: unexpected status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// metadata загружает документ discovery при первом обращении и кэширует его
+func (p *oidcProvider) metadata(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, p.issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// publicKey возвращает ключ подписи по kid. Неизвестный kid означает ротацию
+// ключей у провайдера, поэтому JWKS загружается заново.
+func (p *oidcProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	discovery, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := jwk.rsaPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *oidcProvider) lookupKey(kid string) *rsa.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (k jsonWebKey) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus of key %q", k.Kid)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid exponent of key %q", k.Kid)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizationURL начинает вход: сохраняет state, nonce и PKCE-верификатор
+// и возвращает адрес страницы входа провайдера вместе со state.
+func (p *oidcProvider) authorizationURL(ctx context.Context) (string, string, error) {
+	discovery, err := p.metadata(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := newSecretToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := newSecretToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newSecretToken()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", now).Delete(&OIDCState{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OIDCState{
+			ID:           uuid.New(),
+			StateHash:    hashToken(state),
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			CreatedDate:  now,
+			ExpiresAt:    now.Add(oidcStateExpiresIn),
+		}).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", "", err
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.clientID)
+	query.Set("redirect_uri", p.redirectURL)
+	query.Set("scope", oidcScopes)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", pkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), state, nil
+}
+
+// setOIDCStateCookie запоминает state в браузере; пустой state удаляет cookie
+func setOIDCStateCookie(c *gin.Context, state string) {
+	maxAge := int(oidcStateExpiresIn.Seconds())
+	if state == "" {
+		maxAge = -1
+	}
+	secure := strings.HasPrefix(oidcClient.redirectURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, oidcCookiePath, "", secure, true)
+}
+
+// consumeOIDCState возвращает сохранённые параметры входа; state одноразовый.
+func consumeOIDCState(state string) (*OIDCState, error) {
+	var saved OIDCState
+	if err := db.Where("state_hash = ? AND expires_at > ?", hashToken(state), time.Now()).First(&saved).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errOIDCStateInvalid
+		}
+		return nil, err
+	}
+	result := db.Where("id = ?", saved.ID).Delete(&OIDCState{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errOIDCStateInvalid
+	}
+	return &saved, nil
+}
+
+// exchange обменивает код авторизации на id_token и проверяет его.
+func (p *oidcProvider) exchange(ctx context.Context, code string, state *OIDCState) (*oidcIdentity, error) {
+	discovery, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.clientID},
+		"code_verifier": {state.CodeVerifier},
+	}
+	if p.clientSecret != "" {
+		form.Set("client_secret", p.clientSecret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("token endpoint: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("token endpoint: status %d, error %q", resp.StatusCode, tokens.Error)
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, state.Nonce)
+}
+
+// verifyIDToken проверяет подпись, издателя, получателя, срок действия и nonce.
+func (p *oidcProvider) verifyIDToken(ctx context.Context, rawToken, nonce string) (*oidcIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("id_token: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, fmt.Errorf("id_token: unexpected issuer %q", iss)
+	}
+	if !audienceContains(claims["aud"], p.clientID) {
+		return nil, errors.New("id_token: client is not in the audience")
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.clientID {
+		return nil, fmt.Errorf("id_token: unexpected authorized party %q", azp)
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("id_token: missing exp")
+	}
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("id_token: nonce mismatch")
+	}
+
+	identity := &oidcIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	if identity.Subject == "" {
+		return nil, errors.New("id_token: missing sub")
+	}
+	identity.Email, _ = claims["email"].(string)
+	identity.Email = strings.TrimSpace(identity.Email)
+	// Некоторые провайдеры передают email_verified строкой
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified, _ = strconv.ParseBool(verified)
+	}
+	identity.Username, _ = claims["preferred_username"].(string)
+	return identity, nil
+}
+
+func audienceContains(aud interface{}, clientID string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		for _, value := range aud {
+			if value == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// uniqueUsername подбирает свободное имя пользователя на основе имени у провайдера или email
+func uniqueUsername(tx *gorm.DB, identity *oidcIdentity) (string, error) {
+	base := identity.Username
+	if base == "" {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	base = usernameDisallowed.ReplaceAllString(base, "")
+	if base == "" {
+		base = "user"
+	}
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// resolveOIDCUser находит пользователя по привязанной учётной записи провайдера.
+// При первом входе учётная запись привязывается к пользователю с тем же
+// подтверждённым email, а если такого нет — создаётся новый пользователь.
+// К неактивированному пользователю учётная запись не привязывается: его мог
+// заранее зарегистрировать кто угодно, зная пароль, и после привязки получил
+// бы доступ к аккаунту владельца адреса.
+func resolveOIDCUser(issuer string, identity *oidcIdentity) (*User, error) {
+	var user User
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var linked UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, identity.Subject).First(&linked).Error
+		if err == nil {
+			if err := tx.First(&user, linked.UserId).Error; err != nil {
+				return err
+			}
+			return tx.Model(&linked).Updates(map[string]interface{}{"last_login_at": now, "email": identity.Email}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if identity.Email == "" || !identity.EmailVerified {
+			return errOIDCEmailNotVerified
+		}
+		err = tx.Where("email = ?", identity.Email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if user, err = createOIDCUser(tx, identity); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else if !user.IsActivated {
+			return errOIDCNotActivated
+		}
+		return tx.Create(&UserIdentity{
+			ID:          uuid.New(),
+			UserId:      user.ID,
+			Issuer:      issuer,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			CreatedDate: now,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func createOIDCUser(tx *gorm.DB, identity *oidcIdentity) (User, error) {
+	username, err := uniqueUsername(tx, identity)
+	if err != nil {
+		return User{}, err
+	}
+	// Пароль неизвестен никому; задать свой можно через сброс пароля
+	password, err := newSecretToken()
+	if err != nil {
+		return User{}, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+	user := User{
+		Username:       username,
+		Email:          identity.Email,
+		Password:       string(hashedPassword),
+		IsActivated:    true,
+		ActivationLink: uuid.New().String(),
+		ROLE:           "USER",
+		TimeZone:       "UTC",
+	}
+	return user, tx.Create(&user).Error
+}
+
+// redirectToClient возвращает пользователя в клиент. Параметры передаются во
+// фрагменте адреса, чтобы токены не попадали в логи серверов и заголовок Referer.
+func redirectToClient(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, os.Getenv("CLIENT_URL")+"/sso-callback#"+values.Encode())
+}
+
+func redirectOIDCError(c *gin.Context, message string) {
+	redirectToClient(c, url.Values{"error": {message}})
+}
+
+// GetOIDCConfig сообщает клиенту, доступен ли вход через провайдера.
+func GetOIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": oidcClient != nil})
+}
+
+// OIDCLogin перенаправляет пользователя на страницу входа провайдера
+// (authorization code flow с PKCE).
+func OIDCLogin(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	if oidcClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+	authURL, state, err := oidcClient.authorizationURL(c.Request.Context())
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "oidcLogin",
+			"error":  err.Error(),
+		}).Error("Error starting single sign-on")
+		redirectOIDCError(c, "Single sign-on is unavailable")
+		return
+	}
+	setOIDCStateCookie(c, state)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback принимает код авторизации от провайдера, входит в учётную
+// запись пользователя и возвращает его в клиент с парой токенов.
+func OIDCCallback(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	if oidcClient == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+	if providerError := c.Query("error"); providerError != "" {
+		log.WithFields(logrus.Fields{
+			"action": "oidcCallback",
+			"error":  providerError,
+		}).Warn("Identity provider returned an error")
+		redirectOIDCError(c, "Single sign-on was cancelled or failed")
+		return
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		redirectOIDCError(c, "Invalid single sign-on response")
+		return
+	}
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, "")
+	if subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		log.WithFields(logrus.Fields{
+			"action": "oidcCallback",
+		}).Warn("Single sign-on state does not match the browser")
+		redirectOIDCError(c, "Single sign-on session expired, please try again")
+		return
+	}
+
+	saved, err := consumeOIDCState(state)
+	if err != nil {
+		if !errors.Is(err, errOIDCStateInvalid) {
+			log.WithFields(logrus.Fields{
+				"action": "oidcCallback",
+				"error":  err.Error(),
+			}).Error("Error loading single sign-on state")
+		}
+		redirectOIDCError(c, "Single sign-on session expired, please try again")
+		return
+	}
+
+	identity, err := oidcClient.exchange(c.Request.Context(), code, saved)
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "oidcCallback",
+			"error":  err.Error(),
+		}).Error("Error verifying identity provider response")
+		redirectOIDCError(c, "Single sign-on failed")
+		return
+	}
+
+	user, err := resolveOIDCUser(oidcClient.issuer, identity)
+	if errors.Is(err, errOIDCEmailNotVerified) {
+		redirectOIDCError(c, "Your identity provider account has no verified email address")
+		return
+	}
+	if errors.Is(err, errOIDCNotActivated) {
+		redirectOIDCError(c, "An account with this email is not activated yet. Activate it with the link from the email, then sign in")
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action":  "oidcCallback",
+			"subject": identity.Subject,
+			"error":   err.Error(),
+		}).Error("Error resolving single sign-on user")
+		redirectOIDCError(c, "Failed to sign in")
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "oidcCallback",
+		"userId": user.ID,
+	}).Info("User signed in with single sign-on")
+
+	if user.TOTPEnabled {
+		challengeToken, err := startTwoFactorChallenge(user)
+		if err != nil {
+			redirectOIDCError(c, "Failed to start two-factor login")
+			return
+		}
+		redirectToClient(c, url.Values{"challengeToken": {challengeToken}})
+		return
+	}
+
+	tokens, err := issueTokens(c, user)
+	if err != nil {
+		redirectOIDCError(c, "Failed to generate token")
+		return
+	}
+	redirectToClient(c, url.Values{
+		"token":        {tokens.Token},
+		"refreshToken": {tokens.RefreshToken},
+		"expiresIn":    {strconv.Itoa(tokens.ExpiresIn)},
+	})
+}
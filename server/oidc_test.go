@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testOIDCClientID = "todo-app"
+
+// testIssuer — провайдер OIDC на httptest: discovery, JWKS и token endpoint.
+// Коды авторизации выдаёт authorize вместо страницы входа.
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]testGrant
+}
+
+// testGrant — выданный код авторизации: PKCE challenge и утверждения id_token
+type testGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key, grants: map[string]testGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []jsonWebKey{{
+			Kid: "test",
+			Kty: "RSA",
+			Use: "sig",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) token(w http.ResponseWriter, r *http.Request) {
+	i.mu.Lock()
+	grant, ok := i.grants[r.PostFormValue("code")]
+	delete(i.grants, r.PostFormValue("code"))
+	i.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method != http.MethodPost || r.PostFormValue("grant_type") != "authorization_code":
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_request"})
+	case !ok || r.PostFormValue("client_id") != testOIDCClientID:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_grant"})
+	case pkceChallenge(r.PostFormValue("code_verifier")) != grant.challenge:
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(oidcTokenResponse{Error: "invalid_grant"})
+	default:
+		json.NewEncoder(w).Encode(oidcTokenResponse{IDToken: i.sign(grant.claims, i.key)})
+	}
+}
+
+// claims возвращает корректные утверждения id_token, дополненные extra
+func (i *testIssuer) claims(extra jwt.MapClaims) jwt.MapClaims {
+	claims := jwt.MapClaims{
+		"iss": i.server.URL,
+		"aud": testOIDCClientID,
+		"sub": "subject-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	return claims
+}
+
+func (i *testIssuer) sign(claims jwt.MapClaims, key *rsa.PrivateKey) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// grant выдаёт код авторизации, который обменивается только с верификатором для challenge
+func (i *testIssuer) grant(challenge string, claims jwt.MapClaims) string {
+	code := "code-" + challenge
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.grants[code] = testGrant{challenge: challenge, claims: claims}
+	return code
+}
+
+// authorize играет роль страницы входа: по адресу, на который OIDCLogin
+// отправил браузер, выдаёт код с nonce этого входа
+func (i *testIssuer) authorize(t *testing.T, authURL string, extra jwt.MapClaims) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/authorize" || query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization URL %s", authURL)
+	}
+	claims := i.claims(extra)
+	claims["nonce"] = query.Get("nonce")
+	return i.grant(query.Get("code_challenge"), claims), query.Get("state")
+}
+
+func (i *testIssuer) provider() *oidcProvider {
+	return &oidcProvider{
+		issuer:      i.server.URL,
+		clientID:    testOIDCClientID,
+		redirectURL: "http://api.test/auth/oidc/callback",
+		httpClient:  i.server.Client(),
+	}
+}
+
+func TestOIDCExchangeRequiresPKCEVerifier(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+	state := &OIDCState{Nonce: "nonce", CodeVerifier: "verifier"}
+
+	code := issuer.grant(pkceChallenge("another verifier"), issuer.claims(jwt.MapClaims{"nonce": "nonce"}))
+	if _, err := provider.exchange(context.Background(), code, state); err == nil {
+		t.Fatal("code was exchanged with a verifier that does not match its challenge")
+	}
+
+	code = issuer.grant(pkceChallenge(state.CodeVerifier), issuer.claims(jwt.MapClaims{"nonce": "nonce"}))
+	identity, err := provider.exchange(context.Background(), code, state)
+	if err != nil {
+		t.Fatalf("exchange with the right verifier: %v", err)
+	}
+	if identity.Subject != "subject-1" {
+		t.Fatalf("subject = %q, want subject-1", identity.Subject)
+	}
+}
+
+func TestOIDCVerifyIDTokenRejectsForeignTokens(t *testing.T) {
+	issuer := newTestIssuer(t)
+	provider := issuer.provider()
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := issuer.sign(issuer.claims(jwt.MapClaims{"nonce": "nonce"}), issuer.key)
+	if _, err := provider.verifyIDToken(context.Background(), valid, "nonce"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"nonce":     valid,
+		"audience":  issuer.sign(issuer.claims(jwt.MapClaims{"nonce": "expected", "aud": "another-client"}), issuer.key),
+		"issuer":    issuer.sign(issuer.claims(jwt.MapClaims{"nonce": "expected", "iss": "https://evil.example"}), issuer.key),
+		"expired":   issuer.sign(issuer.claims(jwt.MapClaims{"nonce": "expected", "exp": time.Now().Add(-time.Minute).Unix()}), issuer.key),
+		"signature": issuer.sign(issuer.claims(jwt.MapClaims{"nonce": "expected"}), otherKey),
+		"no sub":    issuer.sign(issuer.claims(jwt.MapClaims{"nonce": "expected", "sub": ""}), issuer.key),
+	} {
+		if _, err := provider.verifyIDToken(context.Background(), token, "expected"); err == nil {
+			t.Errorf("token with a wrong %s was accepted", name)
+		}
+	}
+}
+
+// startOIDCLogin проходит OIDCLogin и страницу входа провайдера и возвращает
+// адрес callback и cookie со state
+func startOIDCLogin(t *testing.T, router http.Handler, issuer *testIssuer, claims jwt.MapClaims) (string, *http.Cookie) {
+	t.Helper()
+	response := performRequest(router, http.MethodGet, "/auth/oidc/login", "", "")
+	if response.Code != http.StatusFound {
+		t.Fatalf("login: status = %d, want 302", response.Code)
+	}
+	var cookie *http.Cookie
+	for _, candidate := range response.Result().Cookies() {
+		if candidate.Name == oidcStateCookie {
+			cookie = candidate
+		}
+	}
+	if cookie == nil || !cookie.HttpOnly {
+		t.Fatalf("login did not set an HttpOnly %s cookie", oidcStateCookie)
+	}
+	code, state := issuer.authorize(t, response.Header().Get("Location"), claims)
+	return "/auth/oidc/callback?" + url.Values{"code": {code}, "state": {state}}.Encode(), cookie
+}
+
+// finishOIDCLogin вызывает callback и возвращает параметры, переданные клиенту
+func finishOIDCLogin(t *testing.T, router http.Handler, callback string, cookie *http.Cookie) url.Values {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, callback, nil)
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+	location := response.Header().Get("Location")
+	if response.Code != http.StatusFound || !strings.HasPrefix(location, "http://client.test/sso-callback#") {
+		t.Fatalf("callback: status = %d, location %q", response.Code, location)
+	}
+	values, err := url.ParseQuery(strings.SplitN(location, "#", 2)[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func setupTestOIDC(t *testing.T) *testIssuer {
+	t.Helper()
+	setupTestDB(t)
+	issuer := newTestIssuer(t)
+	previous := oidcClient
+	oidcClient = issuer.provider()
+	t.Cleanup(func() { oidcClient = previous })
+	return issuer
+}
+
+func TestOIDCFirstLoginCreatesUser(t *testing.T) {
+	issuer := setupTestOIDC(t)
+	router := newRouter()
+	claims := jwt.MapClaims{"email": "carol@example.com", "email_verified": true, "preferred_username": "carol"}
+
+	callback, cookie := startOIDCLogin(t, router, issuer, claims)
+	values := finishOIDCLogin(t, router, callback, cookie)
+	if values.Get("token") == "" || values.Get("refreshToken") == "" {
+		t.Fatalf("first login did not issue tokens: %v", values)
+	}
+	var user User
+	if err := db.First(&user, "email = ?", "carol@example.com").Error; err != nil {
+		t.Fatalf("user was not created: %v", err)
+	}
+	if user.Username != "carol" || !user.IsActivated {
+		t.Fatalf("created user = %+v", user)
+	}
+
+	// Повторный вход находит пользователя по привязанной учётной записи
+	callback, cookie = startOIDCLogin(t, router, issuer, claims)
+	if values := finishOIDCLogin(t, router, callback, cookie); values.Get("token") == "" {
+		t.Fatalf("second login failed: %v", values)
+	}
+	var users, identities int64
+	db.Model(&User{}).Count(&users)
+	db.Model(&UserIdentity{}).Where("user_id = ?", user.ID).Count(&identities)
+	if users != 1 || identities != 1 {
+		t.Fatalf("after two logins: %d users, %d identities; want 1 and 1", users, identities)
+	}
+}
+
+func TestOIDCLoginLinksActivatedAccountByEmail(t *testing.T) {
+	issuer := setupTestOIDC(t)
+	router := newRouter()
+	alice := createTestUser(t, "alice")
+
+	callback, cookie := startOIDCLogin(t, router, issuer, jwt.MapClaims{"email": alice.Email, "email_verified": true})
+	if values := finishOIDCLogin(t, router, callback, cookie); values.Get("token") == "" {
+		t.Fatalf("login was refused: %v", values)
+	}
+	var identity UserIdentity
+	if err := db.First(&identity, "subject = ?", "subject-1").Error; err != nil {
+		t.Fatalf("identity was not linked: %v", err)
+	}
+	if identity.UserId != alice.ID || identity.Issuer != issuer.server.URL {
+		t.Fatalf("identity = %+v, want linked to user %d", identity, alice.ID)
+	}
+}
+
+func TestOIDCLoginRefusesUnlinkableAccounts(t *testing.T) {
+	issuer := setupTestOIDC(t)
+	router := newRouter()
+	// Неактивированный аккаунт мог зарегистрировать кто угодно на чужой адрес
+	mallory := createTestUser(t, "mallory")
+	db.Model(mallory).Update("is_activated", false)
+
+	for name, claims := range map[string]jwt.MapClaims{
+		"unactivated account": {"email": mallory.Email, "email_verified": true},
+		"unverified email":    {"email": "dave@example.com", "email_verified": false},
+	} {
+		callback, cookie := startOIDCLogin(t, router, issuer, claims)
+		values := finishOIDCLogin(t, router, callback, cookie)
+		if values.Get("token") != "" || values.Get("error") == "" {
+			t.Errorf("%s: login was not refused: %v", name, values)
+		}
+	}
+	var identities, users int64
+	db.Model(&UserIdentity{}).Count(&identities)
+	db.Model(&User{}).Count(&users)
+	if identities != 0 || users != 1 {
+		t.Fatalf("refused logins left %d identities and %d users", identities, users)
+	}
+}
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	issuer := setupTestOIDC(t)
+	router := newRouter()
+	claims := jwt.MapClaims{"email": "erin@example.com", "email_verified": true}
+
+	// Callback, начатый в другом браузере, без cookie или с cookie другого входа
+	callback, _ := startOIDCLogin(t, router, issuer, claims)
+	_, otherCookie := startOIDCLogin(t, router, issuer, claims)
+	for name, cookie := range map[string]*http.Cookie{"no cookie": nil, "another login's cookie": otherCookie} {
+		values := finishOIDCLogin(t, router, callback, cookie)
+		if values.Get("token") != "" || values.Get("error") == "" {
+			t.Errorf("%s: callback was accepted: %v", name, values)
+		}
+	}
+	var users int64
+	db.Model(&User{}).Count(&users)
+	if users != 0 {
+		t.Fatalf("rejected callbacks created %d users", users)
+	}
+}
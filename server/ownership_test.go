@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Чужая задача для пользователя не существует: любой запрос к ней отвечает 404
+// и ничего не меняет.
+func TestTaskEndpointsHideOtherUsersTasks(t *testing.T) {
+	setupTestDB(t)
+	router := newRouter()
+
+	owner := createTestUser(t, "owner")
+	intruder := createTestUser(t, "intruder")
+	task := createTestTask(t, owner.ID, Task{Name: "Чужая задача"})
+	child := createTestTask(t, owner.ID, Task{Name: "Чужая подзадача", ParentID: &task.ID})
+	ownTask := createTestTask(t, intruder.ID, Task{Name: "Своя задача"})
+	ownTag := Tag{ID: uuid.New(), Name: "свой", UserId: intruder.ID, CreatedDate: time.Now()}
+	if err := db.Create(&ownTag).Error; err != nil {
+		t.Fatal(err)
+	}
+	authorization := authHeader(t, intruder)
+
+	taskPath := "/api/tasks/" + task.ID.String()
+	for _, tc := range []struct {
+		method, path, body string
+	}{
+		{http.MethodGet, taskPath, ""},
+		{http.MethodPut, taskPath, `{"name":"Захвачено"}`},
+		{http.MethodPatch, taskPath, `{"name":"Захвачено"}`},
+		{http.MethodDelete, taskPath, ""},
+		{http.MethodPut, taskPath + "/toggle-star", ""},
+		{http.MethodPut, taskPath + "/complete", ""},
+		{http.MethodPut, taskPath + "/reopen", ""},
+		{http.MethodGet, taskPath + "/children", ""},
+		{http.MethodPut, taskPath + "/move", `{"parentId":null}`},
+		{http.MethodPut, "/api/tasks/" + ownTask.ID.String() + "/move", fmt.Sprintf(`{"parentId":%q}`, task.ID)},
+		{http.MethodPost, taskPath + "/position", fmt.Sprintf(`{"after":%q}`, child.ID)},
+		{http.MethodPut, taskPath + "/tags/" + ownTag.ID.String(), ""},
+		{http.MethodDelete, taskPath + "/tags/" + ownTag.ID.String(), ""},
+		{http.MethodGet, taskPath + "/reminders", ""},
+		{http.MethodPost, taskPath + "/reminders", `{"channel":"inbox","minutesBefore":0}`},
+		{http.MethodGet, taskPath + "/history", ""},
+	} {
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			response := performRequest(router, tc.method, tc.path, tc.body, authorization)
+			if response.Code != http.StatusNotFound {
+				t.Fatalf("status = %d, want 404; body: %s", response.Code, response.Body)
+			}
+		})
+	}
+
+	var stored Task
+	if err := db.Preload("Tags").First(&stored, "id = ?", task.ID).Error; err != nil {
+		t.Fatalf("owner's task is gone: %v", err)
+	}
+	if stored.Name != task.Name || stored.Version != task.Version || stored.HaveStar || stored.Completed || len(stored.Tags) != 0 {
+		t.Fatalf("owner's task was changed: %+v", stored)
+	}
+	var reminders int64
+	db.Model(&Reminder{}).Where("task_id = ?", task.ID).Count(&reminders)
+	if reminders != 0 {
+		t.Fatalf("a reminder was added to the owner's task")
+	}
+	var moved Task
+	db.First(&moved, "id = ?", ownTask.ID)
+	if moved.ParentID != nil {
+		t.Fatalf("intruder's task was moved under the owner's task")
+	}
+
+	// Свои задачи при этом доступны
+	if response := performRequest(router, http.MethodGet, "/api/tasks/"+ownTask.ID.String(), "", authorization); response.Code != http.StatusOK {
+		t.Fatalf("GET own task: status = %d, want 200", response.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	minPasswordLength      = 8
+	passwordResetExpiresIn = time.Hour
+)
+
+var errPasswordResetUsed = errors.New("password reset token already used")
+
+// PasswordReset — одноразовая ссылка на сброс пароля. Токен хранится только в виде хэша.
+type PasswordReset struct {
+	ID          uuid.UUID `gorm:"primaryKey"`
+	UserId      uint      `gorm:"index"`
+	TokenHash   string    `gorm:"uniqueIndex"`
+	CreatedDate time.Time
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("Password must be at least %d characters long", minPasswordLength)
+	}
+	return nil
+}
+
+// setPassword сохраняет новый пароль и завершает сессии пользователя, кроме keepSession.
+// Неиспользованные ссылки на сброс пароля тоже перестают действовать.
+func setPassword(tx *gorm.DB, userId uint, password string, keepSession uuid.UUID) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(&User{}).Where("id = ?", userId).Update("password", string(hashedPassword)).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&PasswordReset{}).Where("user_id = ? AND used_at IS NULL", userId).Update("used_at", time.Now()).Error; err != nil {
+		return err
+	}
+	_, err = revokeUserSessions(tx, userId, keepSession)
+	return err
+}
+
+func SendPasswordResetEmail(to, token string) error {
+	link := fmt.Sprintf("%s/reset-password?token=%s", os.Getenv("CLIENT_URL"), url.QueryEscape(token))
+	body := fmt.Sprintf("Click <a href=\"%s\">here</a> to reset your password. The link is valid for %d minutes and can be used once. "+
+		"If you did not request a password reset, ignore this email.", link, int(passwordResetExpiresIn.Minutes()))
+	return SendEmail(to, "Reset your password", body)
+}
+
+// ForgotPassword отправляет ссылку на сброс пароля. Ответ не зависит от того,
+// существует ли пользователь, чтобы по нему нельзя было проверять адреса.
+func ForgotPassword(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var request ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	response := gin.H{"message": "If the account exists, a password reset link has been sent"}
+
+	var user User
+	if err := db.Where("email = ?", request.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create password reset"})
+		return
+	}
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Действует только последняя ссылка
+		if err := tx.Model(&PasswordReset{}).Where("user_id = ? AND used_at IS NULL", user.ID).Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&PasswordReset{
+			ID:          uuid.New(),
+			UserId:      user.ID,
+			TokenHash:   hashToken(token),
+			CreatedDate: now,
+			ExpiresAt:   now.Add(passwordResetExpiresIn),
+		}).Error
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "forgotPassword",
+			"error":  err.Error(),
+		}).Error("Error creating password reset")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create password reset"})
+		return
+	}
+
+	if err := SendPasswordResetEmail(user.Email, token); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "forgotPassword",
+			"userId": user.ID,
+			"error":  err.Error(),
+		}).Error("Error sending password reset email")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send password reset email"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "forgotPassword",
+		"userId": user.ID,
+	}).Info("Password reset link sent")
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword устанавливает новый пароль по ссылке из письма и завершает все сессии.
+func ResetPassword(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var request ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := validatePassword(request.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	var reset PasswordReset
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(request.Token), now).First(&reset).Error; err != nil {
+			return err
+		}
+		// Условие на used_at делает ссылку одноразовой и при параллельных запросах
+		result := tx.Model(&PasswordReset{}).Where("id = ? AND used_at IS NULL", reset.ID).Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPasswordResetUsed
+		}
+		return setPassword(tx, reset.UserId, request.Password, uuid.Nil)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errPasswordResetUsed) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset link"})
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "resetPassword",
+			"error":  err.Error(),
+		}).Error("Error resetting password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "resetPassword",
+		"userId": reset.UserId,
+	}).Info("Password reset successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+// ChangePassword меняет пароль после проверки текущего. Остальные сессии
+// завершаются, текущая остаётся активной.
+func ChangePassword(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	var request ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if err := validatePassword(request.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, principal.UserId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid current password"})
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return setPassword(tx, user.ID, request.NewPassword, principal.SessionID)
+	}); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "changePassword",
+			"error":  err.Error(),
+		}).Error("Error changing password")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "changePassword",
+		"userId": user.ID,
+	}).Info("Password changed successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var errTaskVersionConflict = errors.New("task version conflict")
+
+// patchableTaskFields — поля, которые можно менять через PATCH /tasks/:id
+var patchableTaskFields = map[string]bool{
+	"name":       true,
+	"details":    true,
+	"star":       true,
+	"priority":   true,
+	"projectId":  true,
+	"dueAt":      true,
+	"dueHasTime": true,
+	"completed":  true,
+	"recurrence": true,
+}
+
+// readOnlyTaskFields входят в представление задачи, но ими распоряжается
+// сервер или они меняются через отдельные эндпоинты.
+var readOnlyTaskFields = map[string]string{
+	"ID":               "",
+	"userId":           "",
+	"createdDate":      "",
+	"lastUpdated":      "",
+	"version":          "",
+	"deletedAt":        "используйте DELETE /api/tasks/:id",
+	"nextOccurrenceId": "",
+	"completedAt":      "используйте поле completed",
+	"parentId":         "используйте POST /api/tasks/:id/move",
+	"tags":             "используйте /api/tasks/:id/tags/:tagId",
+	"overdue":          "",
+	"progress":         "",
+	"position":         "используйте POST /api/tasks/:id/position",
+}
+
+func sortedPatchableTaskFields() []string {
+	fields := make([]string, 0, len(patchableTaskFields))
+	for field := range patchableTaskFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func taskETag(task *Task) string {
+	return fmt.Sprintf("\"%d\"", task.Version)
+}
+
+// checkIfMatch проверяет условие If-Match. Без заголовка запрос выполняется как раньше.
+func checkIfMatch(c *gin.Context, task *Task) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+	etag := taskETag(task)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	c.Header("ETag", etag)
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Задача была изменена, обновите её и повторите запрос", "version": task.Version})
+	return false
+}
+
+// respondVersionConflict сообщает о записи, которую между чтением и сохранением
+// задачи опередило другое обновление.
+func respondVersionConflict(c *gin.Context, task *Task, status int) {
+	var current Task
+	db.Select("version").First(&current, "id = ?", task.ID)
+	c.Header("ETag", taskETag(&current))
+	c.JSON(status, gin.H{"error": "Задача была изменена, обновите её и повторите запрос", "version": current.Version})
+}
+
+// saveTaskVersioned записывает все колонки задачи, только если в базе всё ещё
+// та версия, с которой её прочитали, и увеличивает версию. Save здесь не
+// подходит: если ни одна строка не совпала, он делает upsert.
+func saveTaskVersioned(tx *gorm.DB, task *Task) error {
+	expected := task.Version
+	task.Version = expected + 1
+	result := tx.Model(task).Where("version = ?", expected).Omit(clause.Associations).Select("*").Updates(task)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = errTaskVersionConflict
+	}
+	if result.Error != nil {
+		task.Version = expected
+	}
+	return result.Error
+}
+
+// applyMergePatch применяет JSON Merge Patch (RFC 7396) к разобранному документу.
+func applyMergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = applyMergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+// requestError — отказ в операции над задачей; status — код ответа
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// respondRequestError отвечает на ошибки входных данных операций над задачами
+func respondRequestError(c *gin.Context, err error) {
+	if re, ok := err.(*requestError); ok {
+		c.JSON(re.status, gin.H{"error": re.message})
+		return
+	}
+	respondQueryError(c, err)
+}
+
+// applyTaskPatch проверяет merge patch по списку изменяемых полей и применяет
+// его к задаче.
+func applyTaskPatch(task *Task, patch map[string]interface{}) error {
+	for field := range patch {
+		if patchableTaskFields[field] {
+			continue
+		}
+		message := fmt.Sprintf("Неизвестное поле %q", field)
+		if hint, readOnly := readOnlyTaskFields[field]; readOnly {
+			message = fmt.Sprintf("Поле %q нельзя изменить", field)
+			if hint != "" {
+				message += ": " + hint
+			}
+		}
+		return &queryError{message: message, allowed: sortedPatchableTaskFields()}
+	}
+
+	var document interface{}
+	data, _ := json.Marshal(task)
+	json.Unmarshal(data, &document)
+	data, _ = json.Marshal(applyMergePatch(document, patch))
+	var patched Task
+	if err := json.Unmarshal(data, &patched); err != nil {
+		return &requestError{status: http.StatusBadRequest, message: "Ошибка входных данных: " + err.Error()}
+	}
+
+	task.Name = patched.Name
+	task.Details = patched.Details
+	task.HaveStar = patched.HaveStar
+	task.Priority = patched.Priority
+	task.ProjectID = patched.ProjectID
+	task.DueAt = patched.DueAt
+	task.DueHasTime = patched.DueHasTime
+	task.Completed = patched.Completed
+	task.Recurrence = patched.Recurrence
+	return nil
+}
+
+// prepareTaskUpdate нормализует изменённую задачу перед сохранением
+func prepareTaskUpdate(task *Task, before TaskSnapshot) error {
+	if task.ParentID != nil && !sameUUID(before.ProjectID, task.ProjectID) {
+		return &requestError{status: http.StatusBadRequest, message: "Подзадача всегда находится в проекте родителя"}
+	}
+	if err := task.normalizeRecurrence(); err != nil {
+		return &requestError{status: http.StatusBadRequest, message: "Неверное правило повторения: " + err.Error()}
+	}
+
+	task.LastUpdated = time.Now()
+	task.normalizeDue(userLocation(task.UserId))
+	task.syncCompletion()
+	if err := task.validatePriority(); err != nil {
+		return err
+	}
+
+	if task.ProjectID != nil && !projectBelongsTo(*task.ProjectID, task.UserId) {
+		return &requestError{status: http.StatusBadRequest, message: "Проект не найден"}
+	}
+	return nil
+}
+
+// updateTask сохраняет подготовленную задачу с проверкой прочитанной версии.
+// Если задача сменила проект, она вместе с подзадачами встаёт в конец нового
+// проекта. Затем переносятся напоминания, пишется история, а у только что
+// выполненной повторяющейся задачи создаётся следующее вхождение.
+func updateTask(tx *gorm.DB, task *Task, before TaskSnapshot, wasCompleted bool, userId uint, revisionAction string) error {
+	projectChanged := task.ParentID == nil && !sameUUID(before.ProjectID, task.ProjectID)
+	if projectChanged {
+		position, err := appendPosition(tx, taskListOf(task))
+		if err != nil {
+			return err
+		}
+		task.Position = position
+	}
+	if err := saveTaskVersioned(tx, task); err != nil {
+		return err
+	}
+	if projectChanged {
+		if err := moveSubtreeToProject(tx, task.ID, task.ProjectID, task.LastUpdated); err != nil {
+			return err
+		}
+	}
+	if err := rescheduleReminders(tx, task); err != nil {
+		return err
+	}
+	if err := recordRevision(tx, task, &before, userId, revisionAction, nil); err != nil {
+		return err
+	}
+	if !wasCompleted && task.Completed {
+		_, err := spawnNextOccurrence(tx, task)
+		return err
+	}
+	return nil
+}
+
+// saveTaskUpdate — общий хвост PUT и PATCH.
+func saveTaskUpdate(c *gin.Context, action, revisionAction string, task *Task, before TaskSnapshot, wasCompleted bool, userId uint) {
+	if err := prepareTaskUpdate(task, before); err != nil {
+		respondRequestError(c, err)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return updateTask(tx, task, before, wasCompleted, userId, revisionAction)
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		// 412 отвечает только на условие клиента, без If-Match это обычный конфликт записи
+		status := http.StatusConflict
+		if c.GetHeader("If-Match") != "" {
+			status = http.StatusPreconditionFailed
+		}
+		respondVersionConflict(c, task, status)
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error updating task in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":  action,
+		"taskID":  task.ID,
+		"version": task.Version,
+	}).Info("Task updated successfully")
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, task)
+}
+
+// PatchTask частично обновляет задачу по JSON Merge Patch (RFC 7396):
+// отсутствующие поля не меняются, null сбрасывает значение.
+// Служебные поля изменить нельзя — запрос с ними отклоняется целиком.
+func PatchTask(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	if contentType := c.ContentType(); contentType != "application/merge-patch+json" && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Ожидается Content-Type: application/merge-patch+json"})
+		return
+	}
+
+	task, principal, ok := findUserTask(c, "patchTask", db)
+	if !ok || !checkIfMatch(c, &task) {
+		return
+	}
+
+	var patch map[string]interface{}
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Тело запроса должно быть JSON-объектом"})
+		return
+	}
+
+	before := snapshotOf(&task)
+	wasCompleted := task.Completed
+	if err := applyTaskPatch(&task, patch); err != nil {
+		respondRequestError(c, err)
+		return
+	}
+
+	saveTaskUpdate(c, "patchTask", "patch", &task, before, wasCompleted, principal.UserId)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// rankDigits — алфавит позиций. Позиции сравниваются побайтно (колонка
+// использует collation ucs_basic), поэтому порядок символов здесь совпадает
+// с порядком задач в списке.
+const rankDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// maxRankLength — длина позиции, после которой список перенумеровывается
+const maxRankLength = 12
+
+// rankBetween возвращает позицию строго между a и b; пустая a — начало списка,
+// пустая b — его конец. Результат не оканчивается младшей цифрой, поэтому перед
+// ним всегда остаётся место для вставки.
+func rankBetween(a, b string) string {
+	if a != "" && b == "" {
+		return rankAfter(a)
+	}
+	var rank []byte
+	for i := 0; ; i++ {
+		lo := 0
+		if i < len(a) {
+			lo = strings.IndexByte(rankDigits, a[i])
+		}
+		hi := len(rankDigits)
+		if b != "" && i < len(b) {
+			hi = strings.IndexByte(rankDigits, b[i])
+		}
+		if hi-lo > 1 {
+			return string(append(rank, rankDigits[(lo+hi)/2]))
+		}
+		rank = append(rank, rankDigits[lo])
+		if hi-lo == 1 {
+			// Префикс уже меньше b, дальше ограничивает только a
+			b = ""
+		}
+	}
+}
+
+// rankAfter возвращает позицию больше a для конца списка. Деление промежутка
+// пополам удлиняло бы позицию на символ каждые несколько добавлений, поэтому
+// позиция увеличивается на единицу при своей длине. Места нет только у позиции
+// из одних старших цифр: она удваивается в длине, и следующих добавлений
+// хватает надолго.
+func rankAfter(a string) string {
+	rank := []byte(a)
+	for i := len(rank) - 1; i >= 0; i-- {
+		digit := strings.IndexByte(rankDigits, rank[i])
+		if digit < len(rankDigits)-1 {
+			rank[i] = rankDigits[digit+1]
+			if last := len(rank) - 1; rank[last] == rankDigits[0] {
+				// Перенос обнулил младшие разряды, а позиция не оканчивается нулём
+				rank[last] = rankDigits[1]
+			}
+			return string(rank)
+		}
+		rank[i] = rankDigits[0]
+	}
+	return a + strings.Repeat(rankDigits[:1], len(a)-1) + rankDigits[1:2]
+}
+
+// rankSequence возвращает n равномерно распределённых позиций одной длины
+func rankSequence(n int) []string {
+	width, space := 1, int64(len(rankDigits))
+	for space < int64(n+1)*int64(len(rankDigits)) {
+		width++
+		space *= int64(len(rankDigits))
+	}
+	step := space / int64(n+1)
+	ranks := make([]string, n)
+	for i := range ranks {
+		value := int64(i+1) * step
+		rank := make([]byte, width)
+		for j := width - 1; j >= 0; j-- {
+			rank[j] = rankDigits[value%int64(len(rankDigits))]
+			value /= int64(len(rankDigits))
+		}
+		ranks[i] = string(rank)
+	}
+	return ranks
+}
+
+// taskList определяет список, внутри которого задачи упорядочиваются вручную:
+// подзадачи одного родителя или корневые задачи одного проекта
+type taskList struct {
+	UserId    uint
+	ProjectID *uuid.UUID
+	ParentID  *uuid.UUID
+}
+
+func taskListOf(task *Task) taskList {
+	if task.ParentID != nil {
+		// Подзадача всегда в проекте родителя, список задаёт только он
+		return taskList{UserId: task.UserId, ParentID: task.ParentID}
+	}
+	return taskList{UserId: task.UserId, ProjectID: task.ProjectID}
+}
+
+func (l taskList) equal(other taskList) bool {
+	return l.UserId == other.UserId && sameUUID(l.ProjectID, other.ProjectID) && sameUUID(l.ParentID, other.ParentID)
+}
+
+func sameUUID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (l taskList) scope(query *gorm.DB) *gorm.DB {
+	query = query.Scopes(taskScope(l.UserId))
+	if l.ParentID != nil {
+		return query.Where("tasks.parent_id = ?", *l.ParentID)
+	}
+	query = query.Where("tasks.parent_id IS NULL")
+	if l.ProjectID != nil {
+		return query.Where("tasks.project_id = ?", *l.ProjectID)
+	}
+	return query.Where("tasks.project_id IS NULL")
+}
+
+// appendPosition возвращает позицию в конце списка
+func appendPosition(tx *gorm.DB, list taskList) (string, error) {
+	var last *string
+	if err := tx.Model(&Task{}).Scopes(list.scope).Select("MAX(tasks.position)").Scan(&last).Error; err != nil {
+		return "", err
+	}
+	if last == nil {
+		return rankBetween("", ""), nil
+	}
+	return rankBetween(*last, ""), nil
+}
+
+// rebalanceList перенумеровывает список короткими равномерными позициями,
+// сохраняя порядок. Задачи без позиции встают в конец в порядке создания.
+// Версии увеличиваются: параллельное перемещение, посчитанное по старым
+// соседям, не пройдёт проверку версии вместо того, чтобы встать не туда.
+func rebalanceList(tx *gorm.DB, list taskList) error {
+	var ids []uuid.UUID
+	if err := tx.Model(&Task{}).Scopes(list.scope).
+		Order("tasks.position = ''").Order("tasks.position").Order("tasks.created_date").Order("tasks.id").
+		Pluck("tasks.id", &ids).Error; err != nil {
+		return err
+	}
+	for i, rank := range rankSequence(len(ids)) {
+		err := tx.Model(&Task{}).Where("id = ?", ids[i]).UpdateColumns(map[string]interface{}{
+			"position": rank,
+			"version":  gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type positionRequest struct {
+	Before *uuid.UUID `json:"before"`
+	After  *uuid.UUID `json:"after"`
+}
+
+// RepositionTask ставит задачу непосредственно перед задачей before или после
+// задачи after из того же списка. Меняется позиция только перемещаемой задачи.
+func RepositionTask(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, principal, ok := findUserTask(c, "repositionTask", db)
+	if !ok || !checkIfMatch(c, &task) {
+		return
+	}
+
+	var request positionRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	if (request.Before == nil) == (request.After == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите ровно одно из полей before или after"})
+		return
+	}
+	anchorID := request.Before
+	if anchorID == nil {
+		anchorID = request.After
+	}
+	if *anchorID == task.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Задачу нельзя поставить относительно самой себя"})
+		return
+	}
+
+	var anchor Task
+	if err := db.Scopes(taskScope(principal.UserId)).First(&anchor, "tasks.id = ?", *anchorID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Соседняя задача не найдена"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения задачи"})
+		}
+		return
+	}
+	list := taskListOf(&task)
+	if !list.equal(taskListOf(&anchor)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Задачи находятся в разных списках"})
+		return
+	}
+
+	now := time.Now()
+	var position string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if anchor.Position == "" {
+			// Список ещё не пронумерован
+			if err := rebalanceList(tx, list); err != nil {
+				return err
+			}
+			// Перенумерация подняла версию и самой задачи
+			task.Version++
+			if err := tx.Model(&Task{}).Where("id = ?", anchor.ID).Pluck("position", &anchor.Position).Error; err != nil {
+				return err
+			}
+		}
+
+		// Ближайшая к anchor задача с той стороны, куда ставим; пустая строка — край списка
+		neighbours := tx.Model(&Task{}).Scopes(list.scope).Where("tasks.id <> ?", task.ID).Limit(1)
+		if request.Before != nil {
+			neighbours = neighbours.Where("tasks.position < ?", anchor.Position).Order("tasks.position DESC")
+		} else {
+			neighbours = neighbours.Where("tasks.position > ?", anchor.Position).Order("tasks.position")
+		}
+		var found []string
+		if err := neighbours.Pluck("tasks.position", &found).Error; err != nil {
+			return err
+		}
+		neighbour := ""
+		if len(found) > 0 {
+			neighbour = found[0]
+		}
+		if request.Before != nil {
+			position = rankBetween(neighbour, anchor.Position)
+		} else {
+			position = rankBetween(anchor.Position, neighbour)
+		}
+
+		result := tx.Model(&Task{}).Where("id = ? AND version = ?", task.ID, task.Version).Updates(map[string]interface{}{
+			"position":    position,
+			"lastupdated": now,
+			"version":     gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTaskVersionConflict
+		}
+		return nil
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondVersionConflict(c, &task, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "repositionTask",
+			"error":  err.Error(),
+		}).Error("Error changing task position")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка перемещения задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":   "repositionTask",
+		"taskID":   task.ID,
+		"anchorID": anchor.ID,
+		"position": position,
+	}).Info("Task position changed successfully")
+
+	task.Position = position
+	task.LastUpdated = now
+	task.Version++
+	c.Header("ETag", taskETag(&task))
+	c.JSON(http.StatusOK, task)
+}
+
+// RankRebalancer перенумеровывает списки, в которых позиции стали слишком
+// длинными после многих вставок в одно место, есть задачи без позиции
+// (созданные до появления ручной сортировки) или перенесённые задачи делят
+// одну позицию.
+type RankRebalancer struct {
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRankRebalancer() *RankRebalancer {
+	return &RankRebalancer{
+		interval:  time.Hour,
+		batchSize: 100,
+	}
+}
+
+func (r *RankRebalancer) Start(ctx context.Context) {
+	runPeriodically(ctx, r.interval, func(ctx context.Context) {
+		if rebalanced, err := r.RunOnce(ctx); err != nil {
+			log.WithFields(logrus.Fields{
+				"action": "rankRebalancer",
+				"error":  err.Error(),
+			}).Error("Error rebalancing task positions")
+		} else if rebalanced > 0 {
+			log.WithFields(logrus.Fields{
+				"action":     "rankRebalancer",
+				"rebalanced": rebalanced,
+			}).Info("Task positions rebalanced")
+		}
+	})
+}
+
+// RunOnce перенумеровывает все списки, которым это нужно, и возвращает их число
+func (r *RankRebalancer) RunOnce(ctx context.Context) (int, error) {
+	rebalanced := 0
+	for ctx.Err() == nil {
+		var lists []taskList
+		err := db.WithContext(ctx).Model(&Task{}).
+			Select("user_id, CASE WHEN parent_id IS NULL THEN project_id END AS project_id, parent_id").
+			Group("user_id, CASE WHEN parent_id IS NULL THEN project_id END, parent_id").
+			Having("MAX(LENGTH(position)) > ? OR MIN(LENGTH(position)) = 0 OR COUNT(DISTINCT position) < COUNT(*)", maxRankLength).
+			Limit(r.batchSize).Scan(&lists).Error
+		if err != nil || len(lists) == 0 {
+			return rebalanced, err
+		}
+		for _, list := range lists {
+			if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error { return rebalanceList(tx, list) }); err != nil {
+				return rebalanced, err
+			}
+			rebalanced++
+		}
+		if len(lists) < r.batchSize {
+			return rebalanced, nil
+		}
+	}
+	return rebalanced, ctx.Err()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func checkRank(t *testing.T, rank, a, b string) {
+	t.Helper()
+	if rank <= a || (b != "" && rank >= b) {
+		t.Fatalf("rankBetween(%q, %q) = %q, not strictly between", a, b, rank)
+	}
+	if strings.HasSuffix(rank, rankDigits[:1]) {
+		t.Fatalf("rankBetween(%q, %q) = %q ends in the lowest digit", a, b, rank)
+	}
+}
+
+// Добавление в конец списка не должно быстро удлинять позиции
+func TestRankBetweenAppendsStayShort(t *testing.T) {
+	for _, start := range []string{"", "i", "k5", "zz"} {
+		last := start
+		for i := 0; i < 500; i++ {
+			rank := rankBetween(last, "")
+			checkRank(t, rank, last, "")
+			last = rank
+		}
+		if len(last) > 4 {
+			t.Errorf("500 appends after %q grew the rank to %q", start, last)
+		}
+	}
+}
+
+func TestRankBetweenKeepsOrder(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	ranks := []string{rankBetween("", "")}
+	for i := 0; i < 2000; i++ {
+		at := random.Intn(len(ranks) + 1)
+		a, b := "", ""
+		if at > 0 {
+			a = ranks[at-1]
+		}
+		if at < len(ranks) {
+			b = ranks[at]
+		}
+		rank := rankBetween(a, b)
+		checkRank(t, rank, a, b)
+		ranks = append(ranks[:at], append([]string{rank}, ranks[at:]...)...)
+	}
+	if !sort.StringsAreSorted(ranks) {
+		t.Fatal("ranks are out of order")
+	}
+}
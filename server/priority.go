@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Приоритет задачи: 1 (P1) — самый высокий, 4 (P4) — самый низкий, nil — без приоритета
+const maxTaskPriority = 4
+
+const defaultStarPriority = 1
+
+// starPriority — приоритет, который соответствует звезде. Его получают
+// помеченные звездой задачи при миграции и при переключении звезды.
+var starPriority = defaultStarPriority
+
+// loadStarPriority reads STAR_PRIORITY (1–4, default 1).
+func loadStarPriority() (int, error) {
+	value := os.Getenv("STAR_PRIORITY")
+	if value == "" {
+		return defaultStarPriority, nil
+	}
+	priority, ok := parsePriority(value)
+	if !ok {
+		return 0, fmt.Errorf("STAR_PRIORITY must be a priority from 1 to %d, got %q", maxTaskPriority, value)
+	}
+	return priority, nil
+}
+
+// parsePriority принимает приоритет в виде 2 или P2
+func parsePriority(value string) (int, bool) {
+	priority, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(value), "p"))
+	if err != nil || priority < 1 || priority > maxTaskPriority {
+		return 0, false
+	}
+	return priority, true
+}
+
+func priorityValues() []string {
+	values := []string{"none"}
+	for priority := 1; priority <= maxTaskPriority; priority++ {
+		values = append(values, strconv.Itoa(priority))
+	}
+	return values
+}
+
+func (t *Task) validatePriority() error {
+	if t.Priority != nil && (*t.Priority < 1 || *t.Priority > maxTaskPriority) {
+		return &queryError{message: fmt.Sprintf("Приоритет должен быть от 1 до %d или null", maxTaskPriority), allowed: priorityValues()}
+	}
+	return nil
+}
+
+// migrateStarPriority выставляет всем отмеченным звёздочкой задачам приоритет
+// звезды. Запускается один раз, сразу после того как AutoMigrate добавил колонку.
+func migrateStarPriority(tx *gorm.DB) (int64, error) {
+	result := tx.Unscoped().Model(&Task{}).Where("have_star = ? AND priority IS NULL", true).
+		Updates(map[string]interface{}{"priority": starPriority, "version": gorm.Expr("version + 1")})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+type Project struct {
+	ID          uuid.UUID  `gorm:"primaryKey"`
+	Name        string     `json:"name"`
+	Color       string     `json:"color"`
+	UserId      uint       `json:"userId"`
+	Archived    bool       `json:"archived" gorm:"default:false"`
+	ArchivedAt  *time.Time `json:"archivedAt"`
+	CreatedDate time.Time  `json:"createdDate"`
+	LastUpdated time.Time  `json:"lastUpdated" gorm:"column:lastupdated"`
+}
+
+func projectBelongsTo(projectID uuid.UUID, userId uint) bool {
+	var count int64
+	db.Model(&Project{}).Where("id = ? AND user_id = ?", projectID, userId).Count(&count)
+	return count > 0
+}
+
+// findUserProject ищет проект по параметру :id среди проектов текущего пользователя
+func findUserProject(c *gin.Context, action string) (Project, bool) {
+	var project Project
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return project, false
+	}
+
+	projectID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error parsing project ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор проекта"})
+		return project, false
+	}
+
+	if err := db.First(&project, "id = ? AND user_id = ?", projectID, principal.UserId).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error retrieving project")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Проект не найден"})
+		return project, false
+	}
+	return project, true
+}
+
+func GetProjects(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	query := db.Where("user_id = ?", principal.UserId).Order("name")
+	switch c.DefaultQuery("archived", "false") {
+	case "false":
+		query = query.Where("archived = ?", false)
+	case "true":
+		query = query.Where("archived = ?", true)
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное значение archived: допустимы true, false, all"})
+		return
+	}
+
+	var projects []Project
+	if err := query.Find(&projects).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения проектов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+func GetProject(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	project, ok := findUserProject(c, "getProject")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func CreateProject(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var newProject Project
+	if err := c.BindJSON(&newProject); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createProject",
+			"error":  err.Error(),
+		}).Error("Error binding JSON for creating project")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	if newProject.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название проекта обязательно"})
+		return
+	}
+
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	newProject.ID = uuid.New()
+	newProject.UserId = principal.UserId
+	newProject.CreatedDate = time.Now()
+	newProject.LastUpdated = newProject.CreatedDate
+	newProject.Archived = false
+	newProject.ArchivedAt = nil
+
+	if err := db.Create(&newProject).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createProject",
+			"error":  err.Error(),
+		}).Error("Error creating project in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания проекта"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":    "createProject",
+		"projectID": newProject.ID,
+	}).Info("Project created successfully")
+
+	c.JSON(http.StatusCreated, newProject)
+}
+
+func UpdateProject(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	project, ok := findUserProject(c, "updateProject")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "updateProject",
+			"error":  err.Error(),
+		}).Error("Error binding JSON for updating project")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название проекта обязательно"})
+		return
+	}
+
+	project.Name = request.Name
+	project.Color = request.Color
+	project.LastUpdated = time.Now()
+
+	if err := db.Save(&project).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "updateProject",
+			"error":  err.Error(),
+		}).Error("Error updating project in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления проекта"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":    "updateProject",
+		"projectID": project.ID,
+	}).Info("Project updated successfully")
+
+	c.JSON(http.StatusOK, project)
+}
+
+// DeleteProject удаляет проект, а его задачи перемещает в корзину. С параметром tasks=keep
+// задачи не удаляются, а переносятся во «Входящие» (без проекта). Задачи, восстановленные
+// из корзины после удаления проекта, тоже попадают во «Входящие».
+func DeleteProject(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	mode := c.DefaultQuery("tasks", "delete")
+	if mode != "delete" && mode != "keep" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное значение tasks: допустимы delete, keep"})
+		return
+	}
+
+	project, ok := findUserProject(c, "deleteProject")
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if mode == "keep" {
+			// Корневые задачи переносятся как при смене проекта: в конец «Входящих»
+			// в прежнем порядке и с записью в истории, подзадачи — вслед за ними
+			var roots []Task
+			if err := tx.Where("project_id = ? AND user_id = ? AND parent_id IS NULL", project.ID, project.UserId).
+				Order("position = ''").Order("position").Order("created_date").Find(&roots).Error; err != nil {
+				return err
+			}
+			for i := range roots {
+				if err := moveTaskToProject(tx, &roots[i], snapshotOf(&roots[i]), nil, project.UserId); err != nil {
+					return err
+				}
+			}
+		} else if err := tx.Where("project_id = ? AND user_id = ?", project.ID, project.UserId).Delete(&Task{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&project).Error
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "deleteProject",
+			"error":  err.Error(),
+		}).Error("Error deleting project from the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления проекта"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":    "deleteProject",
+		"projectID": project.ID,
+		"tasks":     mode,
+	}).Info("Project deleted successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Проект успешно удален"})
+}
+
+// ArchiveProject скрывает проект и его задачи из списков; данные не удаляются
+func ArchiveProject(c *gin.Context) {
+	setProjectArchived(c, "archiveProject", true)
+}
+
+func UnarchiveProject(c *gin.Context) {
+	setProjectArchived(c, "unarchiveProject", false)
+}
+
+func setProjectArchived(c *gin.Context, action string, archived bool) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	project, ok := findUserProject(c, action)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	project.Archived = archived
+	project.ArchivedAt = nil
+	if archived {
+		project.ArchivedAt = &now
+	}
+	project.LastUpdated = now
+
+	if err := db.Save(&project).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error updating project archive state")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления проекта"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":    action,
+		"projectID": project.ID,
+		"archived":  project.Archived,
+	}).Info("Project archive state changed successfully")
+
+	c.JSON(http.StatusOK, project)
+}
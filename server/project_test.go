@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// С tasks=keep задачи проекта встают в конец «Входящих» в прежнем порядке,
+// а перенос попадает в историю
+func TestDeleteProjectKeepsTasksInInbox(t *testing.T) {
+	setupTestDB(t)
+	router := newRouter()
+	user := createTestUser(t, "alice")
+	project := Project{ID: uuid.New(), Name: "Проект", UserId: user.ID, CreatedDate: time.Now(), LastUpdated: time.Now()}
+	if err := db.Create(&project).Error; err != nil {
+		t.Fatal(err)
+	}
+	inbox := createTestTask(t, user.ID, Task{Name: "Входящая"})
+	first := createTestTask(t, user.ID, Task{Name: "Первая", ProjectID: &project.ID})
+	second := createTestTask(t, user.ID, Task{Name: "Вторая", ProjectID: &project.ID})
+	child := createTestTask(t, user.ID, Task{Name: "Подзадача", ParentID: &second.ID})
+
+	response := performRequest(router, http.MethodDelete, "/api/projects/"+project.ID.String()+"?tasks=keep", "", authHeader(t, user))
+	if response.Code != http.StatusOK {
+		t.Fatalf("delete project: status = %d; body: %s", response.Code, response.Body)
+	}
+
+	var order []string
+	db.Model(&Task{}).Where("user_id = ? AND parent_id IS NULL AND project_id IS NULL", user.ID).Order("position").Pluck("name", &order)
+	want := []string{inbox.Name, first.Name, second.Name}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("inbox order = %v, want %v", order, want)
+	}
+	var moved Task
+	db.First(&moved, "id = ?", child.ID)
+	if moved.ProjectID != nil {
+		t.Fatal("subtask stayed in the deleted project")
+	}
+	for _, task := range []*Task{first, second} {
+		var revisions int64
+		db.Model(&TaskRevision{}).Where("task_id = ? AND action = ?", task.ID, "move").Count(&revisions)
+		if revisions != 1 {
+			t.Errorf("task %q has %d move revisions, want 1", task.Name, revisions)
+		}
+	}
+}
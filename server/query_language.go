@@ -0,0 +1,490 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// querySyntaxError — ошибка в выражении q. Pos — позиция в символах (с нуля),
+// чтобы клиент мог подсветить место ошибки.
+type querySyntaxError struct {
+	message string
+	pos     int
+	allowed []string
+}
+
+func (e *querySyntaxError) Error() string {
+	return fmt.Sprintf("%s (позиция %d)", e.message, e.pos)
+}
+
+type queryTokenKind int
+
+const (
+	tokenTerm queryTokenKind = iota
+	tokenNot
+	tokenOr
+	tokenOpen
+	tokenClose
+)
+
+type queryToken struct {
+	kind   queryTokenKind
+	pos    int
+	key    string
+	op     string
+	value  string
+	quoted bool
+}
+
+// taskQuery — скомпилированное выражение q=: одно условие SQL в скобках вместе
+// с аргументами, готовое для Where в gorm.
+type taskQuery struct {
+	condition string
+	args      []interface{}
+	// completion выставляется, когда выражение само фильтрует по выполнению,
+	// и status=open по умолчанию не должен прятать выполненные задачи.
+	completion bool
+}
+
+var queryOperators = []string{"<=", ">=", ":", "<", ">", "="}
+
+func isQueryKey(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenizeTaskQuery разбивает q на термы, "-", OR и скобки. Терм — это либо
+// свободный текст (можно "в кавычках"), либо key<op>value, где значение тоже
+// можно взять в кавычки: project:"Домашние дела".
+func tokenizeTaskQuery(q string) ([]queryToken, error) {
+	var tokens []queryToken
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokenOpen, pos: i})
+			i++
+			continue
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokenClose, pos: i})
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, queryToken{kind: tokenNot, pos: i})
+			i++
+			continue
+		}
+
+		start := i
+		var raw strings.Builder
+		quoted := false
+		quoteAt := 0
+		for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+			if runes[i] != '"' {
+				raw.WriteRune(runes[i])
+				i++
+				continue
+			}
+			if !quoted {
+				quoteAt = raw.Len()
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &querySyntaxError{message: "Незакрытая кавычка", pos: i}
+			}
+			raw.WriteString(string(runes[i+1 : end]))
+			quoted = true
+			i = end + 1
+		}
+
+		text := raw.String()
+		if !quoted && text == "OR" {
+			tokens = append(tokens, queryToken{kind: tokenOr, pos: start})
+			continue
+		}
+		if !quoted && text == "AND" {
+			continue // AND подразумевается между условиями
+		}
+
+		token := queryToken{kind: tokenTerm, pos: start, value: text, quoted: quoted}
+		for _, op := range queryOperators {
+			idx := strings.Index(text, op)
+			// оператор должен стоять до открывающей кавычки: "a:b" — это текст
+			if idx <= 0 || (quoted && idx > quoteAt) || !isQueryKey(text[:idx]) {
+				continue
+			}
+			if token.op == "" || idx < len(token.key) || (idx == len(token.key) && len(op) > len(token.op)) {
+				token.key, token.op, token.value = text[:idx], op, text[idx+len(op):]
+			}
+		}
+		if token.op != "" && token.value == "" {
+			return nil, &querySyntaxError{message: fmt.Sprintf("Не указано значение для %s", token.key), pos: start}
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+type taskQueryParser struct {
+	tokens     []queryToken
+	next       int
+	length     int
+	userId     uint
+	now        time.Time
+	loc        *time.Location
+	completion bool
+}
+
+// parseTaskQuery компилирует q в SQL для GetTasks и сохранённых видов. Грамматика:
+//
+//	expr  = and { "OR" and }
+//	and   = unary { unary }
+//	unary = "-" unary | "(" expr ")" | term
+//
+// Ключи, колонки и операторы берутся из фиксированных таблиц; ввод пользователя
+// попадает в базу только связанными аргументами. Для пустого q возвращается nil.
+func parseTaskQuery(q string, userId uint, now time.Time, loc *time.Location) (*taskQuery, error) {
+	tokens, err := tokenizeTaskQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &taskQueryParser{tokens: tokens, length: len([]rune(q)), userId: userId, now: now, loc: loc}
+	condition, args, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.tokens) {
+		return nil, &querySyntaxError{message: "Лишняя закрывающая скобка", pos: p.tokens[p.next].pos}
+	}
+	return &taskQuery{condition: condition, args: args, completion: p.completion}, nil
+}
+
+func (p *taskQueryParser) peek() *queryToken {
+	if p.next < len(p.tokens) {
+		return &p.tokens[p.next]
+	}
+	return nil
+}
+
+// position указывает на текущий токен или на конец строки
+func (p *taskQueryParser) position() int {
+	if token := p.peek(); token != nil {
+		return token.pos
+	}
+	return p.length
+}
+
+func (p *taskQueryParser) parseOr() (string, []interface{}, error) {
+	condition, args, err := p.parseAnd()
+	if err != nil {
+		return "", nil, err
+	}
+	parts := []string{condition}
+	for token := p.peek(); token != nil && token.kind == tokenOr; token = p.peek() {
+		p.next++
+		condition, more, err := p.parseAnd()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, condition)
+		args = append(args, more...)
+	}
+	if len(parts) == 1 {
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " OR ") + ")", args, nil
+}
+
+func (p *taskQueryParser) parseAnd() (string, []interface{}, error) {
+	var parts []string
+	var args []interface{}
+	for token := p.peek(); token != nil && token.kind != tokenOr && token.kind != tokenClose; token = p.peek() {
+		condition, more, err := p.parseUnary()
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, condition)
+		args = append(args, more...)
+	}
+	if len(parts) == 0 {
+		return "", nil, &querySyntaxError{message: "Ожидалось условие", pos: p.position()}
+	}
+	if len(parts) == 1 {
+		return parts[0], args, nil
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args, nil
+}
+
+func (p *taskQueryParser) parseUnary() (string, []interface{}, error) {
+	token := p.peek()
+	p.next++
+	switch token.kind {
+	case tokenNot:
+		if next := p.peek(); next == nil || next.kind == tokenOr || next.kind == tokenClose {
+			return "", nil, &querySyntaxError{message: "Ожидалось условие после «-»", pos: token.pos}
+		}
+		condition, args, err := p.parseUnary()
+		if err != nil {
+			return "", nil, err
+		}
+		return "(NOT " + condition + ")", args, nil
+	case tokenOpen:
+		condition, args, err := p.parseOr()
+		if err != nil {
+			return "", nil, err
+		}
+		if next := p.peek(); next == nil || next.kind != tokenClose {
+			return "", nil, &querySyntaxError{message: "Не закрыта скобка", pos: token.pos}
+		}
+		p.next++
+		return condition, args, nil
+	default:
+		return p.compileTerm(token)
+	}
+}
+
+// taskQueryKeys — поддерживаемые ключи; значение — допустимые операторы
+var taskQueryKeys = map[string][]string{
+	"name":        {":"},
+	"details":     {":"},
+	"star":        {":"},
+	"priority":    queryOperators,
+	"completed":   {":"},
+	"overdue":     {":"},
+	"recurring":   {":"},
+	"is":          {":"},
+	"has":         {":"},
+	"tag":         {":"},
+	"project":     {":"},
+	"due":         queryOperators,
+	"created":     queryOperators,
+	"updated":     queryOperators,
+	"completedAt": queryOperators,
+}
+
+var taskQueryDateColumns = map[string]string{
+	"due":         "due_at",
+	"created":     "created_date",
+	"updated":     "lastupdated",
+	"completedAt": "completed_at",
+}
+
+func likePattern(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(value))
+	return "%" + value + "%"
+}
+
+func (p *taskQueryParser) compileTerm(token *queryToken) (string, []interface{}, error) {
+	if token.op == "" {
+		pattern := likePattern(token.value)
+		return `(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(COALESCE(details, '')) LIKE ? ESCAPE '\')`, []interface{}{pattern, pattern}, nil
+	}
+
+	ops, ok := taskQueryKeys[token.key]
+	if !ok {
+		keys := make([]string, 0, len(taskQueryKeys))
+		for key := range taskQueryKeys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return "", nil, &querySyntaxError{message: fmt.Sprintf("Неизвестный ключ %q", token.key), pos: token.pos, allowed: keys}
+	}
+	op := token.op
+	if op == "=" {
+		op = ":"
+	}
+	allowedOp := false
+	for _, candidate := range ops {
+		allowedOp = allowedOp || candidate == op
+	}
+	if !allowedOp {
+		return "", nil, &querySyntaxError{message: fmt.Sprintf("Оператор %s не поддерживается для %s", token.op, token.key), pos: token.pos + len([]rune(token.key))}
+	}
+	valuePos := token.pos + len([]rune(token.key)) + len(token.op)
+	invalid := func(allowed ...string) error {
+		return &querySyntaxError{message: fmt.Sprintf("Неверное значение %s", token.key), pos: valuePos, allowed: allowed}
+	}
+
+	switch token.key {
+	case "name", "details":
+		return "LOWER(COALESCE(" + token.key + ", '')) LIKE ? ESCAPE '\\'", []interface{}{likePattern(token.value)}, nil
+
+	case "star", "completed", "recurring", "overdue":
+		b, err := strconv.ParseBool(token.value)
+		if err != nil {
+			return "", nil, invalid("true", "false")
+		}
+		switch token.key {
+		case "star":
+			return "have_star = ?", []interface{}{b}, nil
+		case "completed":
+			p.completion = true
+			return "completed = ?", []interface{}{b}, nil
+		case "recurring":
+			if b {
+				return "(recurrence <> '')", nil, nil
+			}
+			return "(recurrence = '' OR recurrence IS NULL)", nil, nil
+		}
+		condition := "(" + overdueCondition + ")"
+		if !b {
+			condition = "(NOT " + condition + ")"
+		}
+		return condition, []interface{}{p.now, startOfDay(p.now, p.loc)}, nil
+
+	case "priority":
+		if !token.quoted && strings.ToLower(token.value) == "none" && op == ":" {
+			return "priority IS NULL", nil, nil
+		}
+		priority, ok := parsePriority(token.value)
+		if !ok {
+			return "", nil, invalid(priorityValues()...)
+		}
+		// P1 — самый высокий приоритет: priority<=2 находит P1 и P2
+		return "(priority IS NOT NULL AND priority " + strings.Replace(op, ":", "=", 1) + " ?)", []interface{}{priority}, nil
+
+	case "is":
+		switch strings.ToLower(token.value) {
+		case "open":
+			p.completion = true
+			return "completed = ?", []interface{}{false}, nil
+		case "completed":
+			p.completion = true
+			return "completed = ?", []interface{}{true}, nil
+		case "starred":
+			return "have_star = ?", []interface{}{true}, nil
+		case "overdue":
+			return "(" + overdueCondition + ")", []interface{}{p.now, startOfDay(p.now, p.loc)}, nil
+		case "recurring":
+			return "(recurrence <> '')", nil, nil
+		case "root":
+			return "parent_id IS NULL", nil, nil
+		case "subtask":
+			return "parent_id IS NOT NULL", nil, nil
+		case "inbox":
+			return "project_id IS NULL", nil, nil
+		}
+		return "", nil, invalid("completed", "inbox", "open", "overdue", "recurring", "root", "starred", "subtask")
+
+	case "has":
+		switch strings.ToLower(token.value) {
+		case "due":
+			return "due_at IS NOT NULL", nil, nil
+		case "project":
+			return "project_id IS NOT NULL", nil, nil
+		case "parent":
+			return "parent_id IS NOT NULL", nil, nil
+		case "priority":
+			return "priority IS NOT NULL", nil, nil
+		case "tags":
+			return "id IN (?)", []interface{}{db.Table("task_tags").Select("task_id")}, nil
+		}
+		return "", nil, invalid("due", "parent", "priority", "project", "tags")
+
+	case "tag":
+		return "id IN (?)", []interface{}{taggedTaskIDs(p.userId, []string{token.value}, false)}, nil
+
+	case "project":
+		if !token.quoted && strings.ToLower(token.value) == "none" {
+			return "project_id IS NULL", nil, nil
+		}
+		projects := db.Model(&Project{}).Select("id").Where("user_id = ? AND LOWER(name) = ?", p.userId, strings.ToLower(token.value))
+		// project_id IS NOT NULL: иначе -project:x потерял бы задачи из «Входящих»
+		return "(project_id IS NOT NULL AND project_id IN (?))", []interface{}{projects}, nil
+	}
+
+	column := taskQueryDateColumns[token.key]
+	if token.key == "completedAt" {
+		p.completion = true
+	}
+	if !token.quoted && strings.ToLower(token.value) == "none" && op == ":" {
+		return column + " IS NULL", nil, nil
+	}
+	start, end, err := p.parseQueryDate(token.value)
+	if err != nil {
+		return "", nil, invalid("YYYY-MM-DD", "RFC 3339", "today", "tomorrow", "yesterday", "7d", "-2w", "3m", "12h")
+	}
+	var condition string
+	var args []interface{}
+	switch {
+	case start.Equal(end):
+		condition, args = column+" "+strings.Replace(op, ":", "=", 1)+" ?", []interface{}{start}
+	case op == ":":
+		condition, args = column+" >= ? AND "+column+" < ?", []interface{}{start, end}
+	case op == "<":
+		condition, args = column+" < ?", []interface{}{start}
+	case op == "<=":
+		condition, args = column+" < ?", []interface{}{end}
+	case op == ">":
+		condition, args = column+" >= ?", []interface{}{end}
+	default:
+		condition, args = column+" >= ?", []interface{}{start}
+	}
+	return "(" + column + " IS NOT NULL AND " + condition + ")", args, nil
+}
+
+// parseQueryDate возвращает интервал, который задаёт значение даты. Календарные
+// значения (2024-05-01, today, 7d, -2w, 3m) покрывают целый день в часовом поясе
+// пользователя; метки RFC 3339 и смещения в часах (12h) — это моменты, start == end.
+func (p *taskQueryParser) parseQueryDate(value string) (time.Time, time.Time, error) {
+	today := startOfDay(p.now, p.loc)
+	day := func(t time.Time) (time.Time, time.Time, error) {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+
+	switch strings.ToLower(value) {
+	case "today":
+		return day(today)
+	case "tomorrow":
+		return day(today.AddDate(0, 0, 1))
+	case "yesterday":
+		return day(today.AddDate(0, 0, -1))
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, p.loc); err == nil {
+		return day(t)
+	}
+
+	if len(value) < 2 {
+		return time.Time{}, time.Time{}, strconv.ErrSyntax
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(value[:len(value)-1], "+"))
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	switch value[len(value)-1] {
+	case 'h':
+		t := p.now.Add(time.Duration(n) * time.Hour)
+		return t, t, nil
+	case 'd':
+		return day(today.AddDate(0, 0, n))
+	case 'w':
+		return day(today.AddDate(0, 0, 7*n))
+	case 'm':
+		return day(today.AddDate(0, n, 0))
+	}
+	return time.Time{}, time.Time{}, strconv.ErrSyntax
+}
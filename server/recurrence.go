@@ -0,0 +1,290 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecurrenceRule — подмножество RRULE из RFC 5545:
+//
+//	FREQ=DAILY;INTERVAL=2
+//	FREQ=WEEKLY;BYDAY=MO,WE,FR
+//	FREQ=MONTHLY;BYMONTHDAY=15   (-1 — последний день месяца)
+//	FREQ=DAILY;INTERVAL=3;FROM=COMPLETION
+//
+// FROM=COMPLETION — наше расширение: следующее повторение отсчитывается от дня
+// выполнения предыдущего, а не от его срока.
+type RecurrenceRule struct {
+	Freq           string
+	Interval       int
+	ByDay          []time.Weekday
+	ByMonthDay     int
+	FromCompletion bool
+}
+
+var rruleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func parseRecurrence(value string) (*RecurrenceRule, error) {
+	rule := &RecurrenceRule{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(value), "RRULE:"), ";") {
+		if part == "" {
+			continue
+		}
+		key, val, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		switch key {
+		case "FREQ":
+			if val != "DAILY" && val != "WEEKLY" && val != "MONTHLY" {
+				return nil, fmt.Errorf("unsupported FREQ %q", val)
+			}
+			rule.Freq = val
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 365 {
+				return nil, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			rule.Interval = n
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				index := -1
+				for i, name := range rruleWeekdays {
+					if name == day {
+						index = i
+					}
+				}
+				if index < 0 {
+					return nil, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, time.Weekday(index))
+			}
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(val)
+			if err != nil || n == 0 || n < -1 || n > 31 {
+				return nil, fmt.Errorf("invalid BYMONTHDAY %q", val)
+			}
+			rule.ByMonthDay = n
+		case "FROM":
+			if val != "COMPLETION" && val != "DUE" {
+				return nil, fmt.Errorf("invalid FROM %q", val)
+			}
+			rule.FromCompletion = val == "COMPLETION"
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("FREQ is required")
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != "WEEKLY" {
+		return nil, errors.New("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if rule.ByMonthDay != 0 && rule.Freq != "MONTHLY" {
+		return nil, errors.New("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if rule.FromCompletion && (len(rule.ByDay) > 0 || rule.ByMonthDay != 0) {
+		return nil, errors.New("FROM=COMPLETION cannot be combined with BYDAY or BYMONTHDAY")
+	}
+	return rule, nil
+}
+
+func (r *RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = rruleWeekdays[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.ByMonthDay != 0 {
+		parts = append(parts, "BYMONTHDAY="+strconv.Itoa(r.ByMonthDay))
+	}
+	if r.FromCompletion {
+		parts = append(parts, "FROM=COMPLETION")
+	}
+	return strings.Join(parts, ";")
+}
+
+// after возвращает первое повторение строго после дня from. Время на часах из
+// from сохраняется: 09:00 остаётся 09:00 и после перехода на летнее время.
+func (r *RecurrenceRule) after(from time.Time, loc *time.Location) time.Time {
+	from = from.In(loc)
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, from.Hour(), from.Minute(), from.Second(), 0, loc)
+	}
+
+	switch r.Freq {
+	case "WEEKLY":
+		if len(r.ByDay) == 0 {
+			return at(from.Year(), from.Month(), from.Day()+7*r.Interval)
+		}
+		// Недели начинаются с понедельника: сначала оставшиеся дни текущей недели,
+		// затем первая подходящая дата через Interval недель.
+		weekday := (int(from.Weekday()) + 6) % 7
+		best := -1
+		for _, day := range r.ByDay {
+			offset := (int(day)+6)%7 - weekday
+			if offset > 0 && (best < 0 || offset < best) {
+				best = offset
+			}
+		}
+		if best > 0 {
+			return at(from.Year(), from.Month(), from.Day()+best)
+		}
+		weekStart := from.Day() - weekday + 7*r.Interval
+		first := 7
+		for _, day := range r.ByDay {
+			if offset := (int(day) + 6) % 7; offset < first {
+				first = offset
+			}
+		}
+		return at(from.Year(), from.Month(), weekStart+first)
+	case "MONTHLY":
+		if r.ByMonthDay != 0 {
+			// BYMONTHDAY может ещё не наступить в текущем месяце. Если месяц короче,
+			// день обрезается до последнего и может совпасть с from — тогда это не
+			// следующее повторение.
+			if day := clipMonthDay(from.Year(), from.Month(), r.ByMonthDay); day > from.Day() {
+				return at(from.Year(), from.Month(), day)
+			}
+		}
+		day := r.ByMonthDay
+		if day == 0 {
+			day = from.Day()
+		}
+		month := time.Date(from.Year(), from.Month()+time.Month(r.Interval), 1, 0, 0, 0, 0, loc)
+		return at(month.Year(), month.Month(), clipMonthDay(month.Year(), month.Month(), day))
+	default:
+		return at(from.Year(), from.Month(), from.Day()+r.Interval)
+	}
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// clipMonthDay приводит день месяца к существующему: -1 и дни после конца
+// месяца становятся его последним днём
+func clipMonthDay(year int, month time.Month, day int) int {
+	if last := daysIn(year, month); day == -1 || day > last {
+		return last
+	}
+	return day
+}
+
+// Next вычисляет срок повторения, следующего за задачей, выполненной в completedAt.
+// Повторения, пропущенные, пока задача была просрочена, не создаются: поздно
+// выполненное дело не оставляет за собой очередь уже просроченных копий.
+func (r *RecurrenceRule) Next(due *time.Time, completedAt time.Time, loc *time.Location) time.Time {
+	today := startOfDay(completedAt, loc)
+	if r.FromCompletion || due == nil {
+		base := today
+		if due != nil {
+			wall := due.In(loc)
+			base = time.Date(today.Year(), today.Month(), today.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, loc)
+		}
+		return r.after(base, loc)
+	}
+
+	next := r.after(*due, loc)
+	for !startOfDay(next, loc).After(today) {
+		next = r.after(next, loc)
+	}
+	return next
+}
+
+// normalizeRecurrence проверяет правило повторения и приводит его к каноническому виду
+func (t *Task) normalizeRecurrence() error {
+	if t.Recurrence == "" {
+		return nil
+	}
+	rule, err := parseRecurrence(t.Recurrence)
+	if err != nil {
+		return err
+	}
+	t.Recurrence = rule.String()
+	return nil
+}
+
+// spawnNextOccurrence создаёт следующее повторение выполненной задачи.
+// Повторная отметка выполнения не создаёт дубликатов: ссылка на созданную задачу хранится в NextOccurrenceID.
+func spawnNextOccurrence(tx *gorm.DB, task *Task) (*Task, error) {
+	if task.Recurrence == "" || task.NextOccurrenceID != nil || task.CompletedAt == nil {
+		return nil, nil
+	}
+	rule, err := parseRecurrence(task.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	loc := userLocation(task.UserId)
+	due := rule.Next(task.DueAt, *task.CompletedAt, loc).UTC()
+	now := time.Now()
+	next := Task{
+		ID:          uuid.New(),
+		Name:        task.Name,
+		Details:     task.Details,
+		CreatedDate: now,
+		HaveStar:    task.HaveStar,
+		Priority:    task.Priority,
+		LastUpdated: now,
+		UserId:      task.UserId,
+		ProjectID:   task.ProjectID,
+		ParentID:    task.ParentID,
+		DueAt:       &due,
+		DueHasTime:  task.DueAt != nil && task.DueHasTime,
+		Recurrence:  task.Recurrence,
+	}
+	if next.Position, err = appendPosition(tx, taskListOf(&next)); err != nil {
+		return nil, err
+	}
+	if err := tx.Omit("Tags").Create(&next).Error; err != nil {
+		return nil, err
+	}
+	if err := recordRevision(tx, &next, nil, task.UserId, "create", nil); err != nil {
+		return nil, err
+	}
+	if err := tx.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT ?, tag_id FROM task_tags WHERE task_id = ?", next.ID, task.ID).Error; err != nil {
+		return nil, err
+	}
+
+	var reminders []Reminder
+	if err := tx.Where("task_id = ?", task.ID).Find(&reminders).Error; err != nil {
+		return nil, err
+	}
+	for _, reminder := range reminders {
+		copied := Reminder{
+			ID:            uuid.New(),
+			TaskID:        next.ID,
+			UserId:        next.UserId,
+			Channel:       reminder.Channel,
+			Target:        reminder.Target,
+			MinutesBefore: reminder.MinutesBefore,
+			Status:        reminderPending,
+			CreatedDate:   now,
+		}
+		copied.schedule(&next, loc)
+		if err := tx.Create(&copied).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Model(&Task{}).Where("id = ?", task.ID).
+		Updates(map[string]interface{}{"next_occurrence_id": next.ID, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return nil, err
+	}
+	task.NextOccurrenceID = &next.ID
+	task.Version++
+	return &next, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustParseRecurrence(t *testing.T, value string) *RecurrenceRule {
+	t.Helper()
+	rule, err := parseRecurrence(value)
+	if err != nil {
+		t.Fatalf("parseRecurrence(%q): %v", value, err)
+	}
+	return rule
+}
+
+func TestRecurrenceRuleAfter(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(loc *time.Location, year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+
+	for _, tc := range []struct {
+		rule string
+		from time.Time
+		want time.Time
+	}{
+		{"FREQ=DAILY", date(time.UTC, 2025, 1, 31, 9), date(time.UTC, 2025, 2, 1, 9)},
+		{"FREQ=DAILY;INTERVAL=3", date(time.UTC, 2025, 1, 1, 9), date(time.UTC, 2025, 1, 4, 9)},
+		// Время на часах сохраняется при переходе на летнее и зимнее время
+		{"FREQ=DAILY", date(berlin, 2025, 3, 29, 9), date(berlin, 2025, 3, 30, 9)},
+		{"FREQ=WEEKLY", date(berlin, 2025, 10, 20, 9), date(berlin, 2025, 10, 27, 9)},
+		// 2025-01-08 — среда
+		{"FREQ=WEEKLY;BYDAY=MO,FR", date(time.UTC, 2025, 1, 8, 9), date(time.UTC, 2025, 1, 10, 9)},
+		{"FREQ=WEEKLY;BYDAY=MO,FR", date(time.UTC, 2025, 1, 10, 9), date(time.UTC, 2025, 1, 13, 9)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", date(time.UTC, 2025, 1, 8, 9), date(time.UTC, 2025, 1, 10, 9)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", date(time.UTC, 2025, 1, 10, 9), date(time.UTC, 2025, 1, 20, 9)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=SU", date(time.UTC, 2025, 1, 12, 9), date(time.UTC, 2025, 1, 26, 9)},
+		{"FREQ=MONTHLY", date(time.UTC, 2025, 1, 15, 9), date(time.UTC, 2025, 2, 15, 9)},
+		{"FREQ=MONTHLY;INTERVAL=2", date(time.UTC, 2025, 11, 15, 9), date(time.UTC, 2026, 1, 15, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", date(time.UTC, 2025, 1, 10, 9), date(time.UTC, 2025, 1, 15, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=15", date(time.UTC, 2025, 1, 15, 9), date(time.UTC, 2025, 2, 15, 9)},
+		// Дни после конца месяца обрезаются до последнего дня, но не возвращают from
+		{"FREQ=MONTHLY;BYMONTHDAY=31", date(time.UTC, 2025, 1, 31, 9), date(time.UTC, 2025, 2, 28, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", date(time.UTC, 2025, 2, 28, 9), date(time.UTC, 2025, 3, 31, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", date(time.UTC, 2025, 4, 30, 9), date(time.UTC, 2025, 5, 31, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=30", date(time.UTC, 2025, 2, 28, 9), date(time.UTC, 2025, 3, 30, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=30", date(time.UTC, 2024, 2, 28, 9), date(time.UTC, 2024, 2, 29, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(time.UTC, 2025, 2, 10, 9), date(time.UTC, 2025, 2, 28, 9)},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", date(time.UTC, 2025, 2, 28, 9), date(time.UTC, 2025, 3, 31, 9)},
+		{"FREQ=MONTHLY;INTERVAL=3;BYMONTHDAY=-1", date(time.UTC, 2025, 1, 31, 9), date(time.UTC, 2025, 4, 30, 9)},
+	} {
+		rule := mustParseRecurrence(t, tc.rule)
+		if got := rule.after(tc.from, tc.from.Location()); !got.Equal(tc.want) {
+			t.Errorf("%s after %v = %v, want %v", tc.rule, tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestRecurrenceRuleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, berlin)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		rule      string
+		due       *time.Time
+		completed time.Time
+		want      time.Time
+	}{
+		{"on time", "FREQ=DAILY", timePtr(date(2025, 1, 1, 9)), date(2025, 1, 1, 8), date(2025, 1, 2, 9)},
+		{"overdue occurrences are skipped", "FREQ=DAILY", timePtr(date(2025, 1, 1, 9)), date(2025, 1, 5, 20), date(2025, 1, 6, 9)},
+		{"overdue weekly", "FREQ=WEEKLY;BYDAY=MO", timePtr(date(2025, 1, 6, 9)), date(2025, 1, 20, 7), date(2025, 1, 27, 9)},
+		{"overdue across DST", "FREQ=DAILY", timePtr(date(2025, 3, 28, 9)), date(2025, 3, 30, 12), date(2025, 3, 31, 9)},
+		{"short month", "FREQ=MONTHLY;BYMONTHDAY=31", timePtr(date(2025, 4, 30, 9)), date(2025, 4, 30, 10), date(2025, 5, 31, 9)},
+		{"short month overdue", "FREQ=MONTHLY;BYMONTHDAY=30", timePtr(date(2025, 1, 30, 9)), date(2025, 2, 28, 10), date(2025, 3, 30, 9)},
+		{"from completion", "FREQ=DAILY;INTERVAL=3;FROM=COMPLETION", timePtr(date(2025, 1, 1, 9)), date(2025, 1, 5, 20), date(2025, 1, 8, 9)},
+		{"without due date", "FREQ=WEEKLY", nil, date(2025, 1, 5, 20), date(2025, 1, 12, 0)},
+	} {
+		rule := mustParseRecurrence(t, tc.rule)
+		if got := rule.Next(tc.due, tc.completed, berlin); !got.Equal(tc.want) {
+			t.Errorf("%s: %s next = %v, want %v", tc.name, tc.rule, got.In(berlin), tc.want)
+		}
+	}
+}
+
+func timePtr(value time.Time) *time.Time {
+	return &value
+}
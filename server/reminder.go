@@ -0,0 +1,526 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	reminderPending   = "pending"
+	reminderSent      = "sent"
+	reminderFailed    = "failed"
+	reminderCancelled = "cancelled"
+
+	reminderMaxAttempts = 5
+)
+
+type Reminder struct {
+	ID            uuid.UUID  `gorm:"primaryKey"`
+	TaskID        uuid.UUID  `json:"taskId" gorm:"index"`
+	UserId        uint       `json:"userId"`
+	Channel       string     `json:"channel"`
+	Target        string     `json:"target"`
+	MinutesBefore int        `json:"minutesBefore"`
+	RemindAt      *time.Time `json:"remindAt" gorm:"index"`
+	Status        string     `json:"status" gorm:"index"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"lastError"`
+	SentAt        *time.Time `json:"sentAt"`
+	LockedBy      string     `json:"-"`
+	LockedUntil   *time.Time `json:"-"`
+	CreatedDate   time.Time  `json:"createdDate"`
+}
+
+// Notification — сообщение во внутреннем почтовом ящике пользователя (канал inbox)
+type Notification struct {
+	ID          uuid.UUID  `gorm:"primaryKey"`
+	UserId      uint       `json:"userId" gorm:"index"`
+	TaskID      *uuid.UUID `json:"taskId"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	CreatedDate time.Time  `json:"createdDate"`
+	ReadAt      *time.Time `json:"readAt"`
+}
+
+// reminderBase — момент, от которого отсчитываются напоминания: срок задачи,
+// а для срока без времени — 09:00 в часовом поясе пользователя
+func reminderBase(task *Task, loc *time.Location) time.Time {
+	if task.DueHasTime {
+		return *task.DueAt
+	}
+	day := task.DueAt.In(loc)
+	return time.Date(day.Year(), day.Month(), day.Day(), 9, 0, 0, 0, loc)
+}
+
+func (r *Reminder) schedule(task *Task, loc *time.Location) {
+	if task.DueAt == nil {
+		r.RemindAt = nil
+		return
+	}
+	remindAt := reminderBase(task, loc).Add(-time.Duration(r.MinutesBefore) * time.Minute).UTC()
+	r.RemindAt = &remindAt
+}
+
+// rescheduleReminders пересчитывает время ожидающих напоминаний после изменения срока задачи
+func rescheduleReminders(tx *gorm.DB, task *Task) error {
+	var reminders []Reminder
+	if err := tx.Where("task_id = ? AND status = ?", task.ID, reminderPending).Find(&reminders).Error; err != nil {
+		return err
+	}
+	loc := userLocation(task.UserId)
+	for i := range reminders {
+		reminders[i].schedule(task, loc)
+		reminders[i].Attempts = 0
+		if err := tx.Model(&reminders[i]).Updates(map[string]interface{}{
+			"remind_at": reminders[i].RemindAt,
+			"attempts":  0,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notifier доставляет наступившее напоминание по одному каналу
+type Notifier interface {
+	Notify(reminder *Reminder, task *Task, user *User) error
+}
+
+type emailNotifier struct{}
+
+func (emailNotifier) Notify(reminder *Reminder, task *Task, user *User) error {
+	body := fmt.Sprintf("Напоминание о задаче <b>%s</b>", html.EscapeString(task.Name))
+	if task.DueAt != nil {
+		body += fmt.Sprintf(", срок: %s", task.DueAt.In(userLocation(user.ID)).Format("02.01.2006 15:04"))
+	}
+	return SendEmail(user.Email, "Напоминание: "+task.Name, body)
+}
+
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// sharedAddressSpace (RFC 6598) не покрывается методами net.IP
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP отсекает адреса, по которым webhook дотянулся бы до внутренней сети
+// сервера: loopback, частные, link-local (в том числе метаданные облака) и служебные.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0))
+}
+
+// checkWebhookTarget проверяет адрес webhook при создании напоминания:
+// все адреса, в которые разрешается имя хоста, должны быть публичными.
+func checkWebhookTarget(ctx context.Context, target string) error {
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return errors.New("webhook target must be an http(s) URL")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// newWebhookClient проверяет адрес непосредственно перед соединением, поэтому
+// ни смена DNS-записи после создания напоминания, ни редирект не ведут во внутреннюю сеть.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errWebhookAddress
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		// Прокси из окружения обошёл бы проверку адреса
+		Transport: &http.Transport{Proxy: nil, DialContext: dialer.DialContext},
+	}
+}
+
+type webhookNotifier struct {
+	client *http.Client
+}
+
+func (n webhookNotifier) Notify(reminder *Reminder, task *Task, user *User) error {
+	payload, err := json.Marshal(gin.H{"reminderId": reminder.ID, "task": task})
+	if err != nil {
+		return err
+	}
+	resp, err := n.client.Post(reminder.Target, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+type inboxNotifier struct{}
+
+func (inboxNotifier) Notify(reminder *Reminder, task *Task, user *User) error {
+	return db.Create(&Notification{
+		ID:          uuid.New(),
+		UserId:      user.ID,
+		TaskID:      &task.ID,
+		Title:       "Напоминание: " + task.Name,
+		Body:        task.Details,
+		CreatedDate: time.Now(),
+	}).Error
+}
+
+func defaultNotifiers() map[string]Notifier {
+	return map[string]Notifier{
+		"email":   emailNotifier{},
+		"webhook": webhookNotifier{client: newWebhookClient()},
+		"inbox":   inboxNotifier{},
+	}
+}
+
+// Clock заменяет time.Now, чтобы в тестах планировщиком управляли поддельные часы
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// runPeriodically вызывает fn в фоне сразу и затем каждые interval, пока ctx не отменён
+func runPeriodically(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			fn(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ReminderScheduler доставляет наступившие напоминания. Состояние хранится в
+// таблице reminders, поэтому при перезапуске ничего не теряется. Планировщик
+// может работать на нескольких репликах сразу: перед отправкой напоминание
+// берётся в аренду условным UPDATE, и отметить его отправленным может только
+// реплика, владеющая арендой. Доставка «хотя бы один раз»: если реплика упадёт
+// между отправкой и отметкой, напоминание уйдёт повторно после истечения аренды.
+type ReminderScheduler struct {
+	clock     Clock
+	owner     string
+	interval  time.Duration
+	lease     time.Duration
+	batchSize int
+	notifiers map[string]Notifier
+}
+
+func NewReminderScheduler(clock Clock, notifiers map[string]Notifier) *ReminderScheduler {
+	host, _ := os.Hostname()
+	return &ReminderScheduler{
+		clock:     clock,
+		owner:     host + "-" + uuid.New().String(),
+		interval:  30 * time.Second,
+		lease:     2 * time.Minute,
+		batchSize: 100,
+		notifiers: notifiers,
+	}
+}
+
+func (s *ReminderScheduler) Start(ctx context.Context) {
+	runPeriodically(ctx, s.interval, func(ctx context.Context) {
+		if _, err := s.RunOnce(ctx); err != nil {
+			log.WithFields(logrus.Fields{
+				"action": "reminderScheduler",
+				"error":  err.Error(),
+			}).Error("Error processing reminders")
+		}
+	})
+}
+
+// RunOnce доставляет все напоминания, наступившие к текущему времени
+// планировщика, и возвращает число отправленных
+func (s *ReminderScheduler) RunOnce(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	var candidates []Reminder
+	err := db.WithContext(ctx).
+		Where("status = ? AND remind_at <= ? AND (locked_until IS NULL OR locked_until < ?)", reminderPending, now, now).
+		// напоминания задач в корзине ждут восстановления или очистки
+		Where("task_id NOT IN (?)", db.Unscoped().Model(&Task{}).Select("id").Where("deleted_at IS NOT NULL")).
+		Order("remind_at").Limit(s.batchSize).Find(&candidates).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range candidates {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if !s.claim(&candidates[i]) {
+			continue
+		}
+		if s.deliver(&candidates[i], s.clock.Now()) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// claim берёт аренду напоминания. Время читается заново для каждого
+// напоминания: отправка предыдущих в пачке может занять дольше аренды, и
+// отсчитанная от начала пачки аренда была бы истёкшей уже при записи.
+func (s *ReminderScheduler) claim(reminder *Reminder) bool {
+	now := s.clock.Now()
+	leaseUntil := now.Add(s.lease)
+	result := db.Model(&Reminder{}).
+		Where("id = ? AND status = ? AND (locked_until IS NULL OR locked_until < ?)", reminder.ID, reminderPending, now).
+		Updates(map[string]interface{}{"locked_by": s.owner, "locked_until": leaseUntil})
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func (s *ReminderScheduler) deliver(reminder *Reminder, now time.Time) bool {
+	var task Task
+	if err := db.First(&task, "id = ?", reminder.TaskID).Error; err != nil || task.Completed {
+		s.finish(reminder, map[string]interface{}{"status": reminderCancelled})
+		return false
+	}
+	var user User
+	if err := db.First(&user, reminder.UserId).Error; err != nil {
+		s.finish(reminder, map[string]interface{}{"status": reminderCancelled})
+		return false
+	}
+
+	notifier, ok := s.notifiers[reminder.Channel]
+	err := fmt.Errorf("unknown channel %q", reminder.Channel)
+	if ok {
+		err = notifier.Notify(reminder, &task, &user)
+	}
+	if err == nil {
+		s.finish(reminder, map[string]interface{}{"status": reminderSent, "sent_at": now, "last_error": ""})
+		log.WithFields(logrus.Fields{
+			"action":     "sendReminder",
+			"reminderID": reminder.ID,
+			"taskID":     task.ID,
+			"channel":    reminder.Channel,
+		}).Info("Reminder sent successfully")
+		return true
+	}
+
+	attempts := reminder.Attempts + 1
+	update := map[string]interface{}{"attempts": attempts, "last_error": err.Error()}
+	if attempts >= reminderMaxAttempts {
+		update["status"] = reminderFailed
+	} else {
+		update["remind_at"] = now.Add(time.Duration(attempts) * time.Minute)
+	}
+	s.finish(reminder, update)
+	log.WithFields(logrus.Fields{
+		"action":     "sendReminder",
+		"reminderID": reminder.ID,
+		"channel":    reminder.Channel,
+		"attempts":   attempts,
+		"error":      err.Error(),
+	}).Error("Error sending reminder")
+	return false
+}
+
+// finish снимает аренду; изменения применяются, только если аренда всё ещё принадлежит этой реплике
+func (s *ReminderScheduler) finish(reminder *Reminder, update map[string]interface{}) {
+	update["locked_by"] = ""
+	update["locked_until"] = nil
+	db.Model(&Reminder{}).Where("id = ? AND locked_by = ?", reminder.ID, s.owner).Updates(update)
+}
+
+func GetTaskReminders(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, _, ok := findUserTask(c, "getTaskReminders", db)
+	if !ok {
+		return
+	}
+
+	var reminders []Reminder
+	if err := db.Where("task_id = ?", task.ID).Order("remind_at").Find(&reminders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения напоминаний"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reminders)
+}
+
+func CreateReminder(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var reminder Reminder
+	if err := c.BindJSON(&reminder); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+
+	switch reminder.Channel {
+	case "email", "inbox":
+		reminder.Target = ""
+	case "webhook":
+		if err := checkWebhookTarget(c.Request.Context(), reminder.Target); err != nil {
+			message := "Для канала webhook нужен адрес http(s)"
+			if errors.Is(err, errWebhookAddress) {
+				message = "Адрес webhook должен быть публичным: внутренние и локальные адреса запрещены"
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": message})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный канал: допустимы email, webhook, inbox"})
+		return
+	}
+	if reminder.MinutesBefore < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "minutesBefore не может быть отрицательным"})
+		return
+	}
+
+	task, principal, ok := findUserTask(c, "createReminder", db)
+	if !ok {
+		return
+	}
+
+	reminder.ID = uuid.New()
+	reminder.TaskID = task.ID
+	reminder.UserId = principal.UserId
+	reminder.Status = reminderPending
+	reminder.Attempts = 0
+	reminder.LastError = ""
+	reminder.SentAt = nil
+	reminder.LockedBy = ""
+	reminder.LockedUntil = nil
+	reminder.CreatedDate = time.Now()
+	reminder.schedule(&task, userLocation(principal.UserId))
+
+	if err := db.Create(&reminder).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createReminder",
+			"error":  err.Error(),
+		}).Error("Error creating reminder in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания напоминания"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":     "createReminder",
+		"reminderID": reminder.ID,
+		"taskID":     task.ID,
+	}).Info("Reminder created successfully")
+
+	c.JSON(http.StatusCreated, reminder)
+}
+
+func DeleteReminder(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	reminderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор напоминания"})
+		return
+	}
+
+	result := db.Where("id = ? AND user_id = ?", reminderID, principal.UserId).Delete(&Reminder{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления напоминания"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Напоминание не найдено"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Напоминание удалено"})
+}
+
+func GetInbox(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	query := db.Where("user_id = ?", principal.UserId).Order("created_date DESC").Limit(100)
+	if unread, _ := strconv.ParseBool(c.Query("unread")); unread {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var notifications []Notification
+	if err := query.Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения уведомлений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор уведомления"})
+		return
+	}
+
+	// Повторная отметка уже прочитанного уведомления не меняет read_at
+	result := db.Model(&Notification{}).
+		Where("id = ? AND user_id = ?", notificationID, principal.UserId).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления уведомления"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Уведомление не найдено"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Уведомление прочитано"})
+}
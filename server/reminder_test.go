@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// recordingNotifier запоминает доставленные напоминания и возвращает err
+type recordingNotifier struct {
+	mu    sync.Mutex
+	calls map[uuid.UUID]int
+	err   error
+}
+
+func (n *recordingNotifier) Notify(reminder *Reminder, task *Task, user *User) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.calls == nil {
+		n.calls = map[uuid.UUID]int{}
+	}
+	n.calls[reminder.ID]++
+	return n.err
+}
+
+func (n *recordingNotifier) count(id uuid.UUID) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls[id]
+}
+
+func newTestScheduler(clock Clock, notifier Notifier) *ReminderScheduler {
+	return NewReminderScheduler(clock, map[string]Notifier{"inbox": notifier})
+}
+
+// createDueReminder создаёт задачу пользователя и ожидающее напоминание, наступившее к remindAt
+func createDueReminder(t *testing.T, user *User, remindAt time.Time) *Reminder {
+	t.Helper()
+	due := remindAt.Add(time.Hour)
+	task := createTestTask(t, user.ID, Task{Name: "Задача", DueAt: &due, DueHasTime: true})
+	reminder := Reminder{
+		ID:          uuid.New(),
+		TaskID:      task.ID,
+		UserId:      user.ID,
+		Channel:     "inbox",
+		RemindAt:    &remindAt,
+		Status:      reminderPending,
+		CreatedDate: remindAt,
+	}
+	if err := db.Create(&reminder).Error; err != nil {
+		t.Fatalf("create reminder: %v", err)
+	}
+	return &reminder
+}
+
+func loadReminder(t *testing.T, id uuid.UUID) Reminder {
+	t.Helper()
+	var reminder Reminder
+	if err := db.First(&reminder, "id = ?", id).Error; err != nil {
+		t.Fatalf("load reminder: %v", err)
+	}
+	return reminder
+}
+
+func TestReminderSchedulerLeaseBlocksOtherReplicas(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+	reminder := createDueReminder(t, user, clock.Now().Add(-time.Minute))
+
+	notifier := &recordingNotifier{}
+	first := newTestScheduler(clock, notifier)
+	second := newTestScheduler(clock, notifier)
+
+	if !first.claim(reminder) {
+		t.Fatal("first scheduler could not claim a free reminder")
+	}
+	if second.claim(reminder) {
+		t.Fatal("second scheduler claimed a leased reminder")
+	}
+	if sent, err := second.RunOnce(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("RunOnce during lease = %d, %v; want 0, nil", sent, err)
+	}
+
+	// Реплика с арендой «упала»; после истечения аренды напоминание доставляет другая
+	clock.Advance(first.lease + time.Second)
+	if sent, err := second.RunOnce(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("RunOnce after lease expiry = %d, %v; want 1, nil", sent, err)
+	}
+	if got := loadReminder(t, reminder.ID); got.Status != reminderSent || got.LockedBy != "" {
+		t.Fatalf("reminder status = %q, locked by %q; want sent and unlocked", got.Status, got.LockedBy)
+	}
+	// Аренда первой реплики снята, её запоздалое завершение ничего не меняет
+	first.finish(reminder, map[string]interface{}{"status": reminderFailed})
+	if got := loadReminder(t, reminder.ID); got.Status != reminderSent {
+		t.Fatalf("stale lease holder changed status to %q", got.Status)
+	}
+}
+
+// notifierFunc позволяет тесту вмешаться в отправку
+type notifierFunc func(reminder *Reminder) error
+
+func (f notifierFunc) Notify(reminder *Reminder, task *Task, user *User) error {
+	return f(reminder)
+}
+
+// Аренда отсчитывается от момента захвата, а не от начала пачки: иначе после
+// долгой отправки первого напоминания второе захватывается с уже истёкшей арендой
+func TestReminderSchedulerLeasesFromClaimTime(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+	slow := createDueReminder(t, user, clock.Now().Add(-2*time.Minute))
+	next := createDueReminder(t, user, clock.Now().Add(-time.Minute))
+
+	other := newTestScheduler(clock, &recordingNotifier{})
+	stolen := false
+	scheduler := newTestScheduler(clock, notifierFunc(func(reminder *Reminder) error {
+		if reminder.ID == slow.ID {
+			clock.Advance(other.lease + time.Minute)
+		} else {
+			stolen = other.claim(next)
+		}
+		return nil
+	}))
+	if sent, err := scheduler.RunOnce(context.Background()); err != nil || sent != 2 {
+		t.Fatalf("RunOnce = %d, %v; want 2, nil", sent, err)
+	}
+	if stolen {
+		t.Fatal("another replica claimed a reminder while it was being sent")
+	}
+}
+
+func TestReminderSchedulerDeliversOnceAcrossReplicas(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+	var reminders []*Reminder
+	for i := 0; i < 20; i++ {
+		reminders = append(reminders, createDueReminder(t, user, clock.Now().Add(-time.Minute)))
+	}
+
+	notifier := &recordingNotifier{}
+	schedulers := []*ReminderScheduler{newTestScheduler(clock, notifier), newTestScheduler(clock, notifier)}
+	var wg sync.WaitGroup
+	sent := make([]int, len(schedulers))
+	for i, scheduler := range schedulers {
+		wg.Add(1)
+		go func(i int, scheduler *ReminderScheduler) {
+			defer wg.Done()
+			var err error
+			if sent[i], err = scheduler.RunOnce(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}(i, scheduler)
+	}
+	wg.Wait()
+
+	if total := sent[0] + sent[1]; total != len(reminders) {
+		t.Fatalf("replicas sent %d reminders in total, want %d", total, len(reminders))
+	}
+	for _, reminder := range reminders {
+		if calls := notifier.count(reminder.ID); calls != 1 {
+			t.Errorf("reminder %s delivered %d times, want 1", reminder.ID, calls)
+		}
+	}
+}
+
+func TestReminderSchedulerRetriesWithBackoff(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+	reminder := createDueReminder(t, user, clock.Now())
+
+	notifier := &recordingNotifier{err: errors.New("channel is down")}
+	scheduler := newTestScheduler(clock, notifier)
+
+	for attempt := 1; attempt <= reminderMaxAttempts; attempt++ {
+		if sent, err := scheduler.RunOnce(context.Background()); err != nil || sent != 0 {
+			t.Fatalf("attempt %d: RunOnce = %d, %v; want 0, nil", attempt, sent, err)
+		}
+		got := loadReminder(t, reminder.ID)
+		if got.Attempts != attempt || got.LastError != "channel is down" {
+			t.Fatalf("attempt %d: attempts = %d, last error %q", attempt, got.Attempts, got.LastError)
+		}
+		if attempt == reminderMaxAttempts {
+			if got.Status != reminderFailed {
+				t.Fatalf("status after %d attempts = %q, want failed", attempt, got.Status)
+			}
+			break
+		}
+		backoff := time.Duration(attempt) * time.Minute
+		if got.Status != reminderPending || !got.RemindAt.Equal(clock.Now().Add(backoff)) {
+			t.Fatalf("attempt %d: status %q, remind at %v; want pending at %v", attempt, got.Status, got.RemindAt, clock.Now().Add(backoff))
+		}
+		// До окончания паузы повторной попытки нет
+		clock.Advance(backoff - time.Second)
+		scheduler.RunOnce(context.Background())
+		if calls := notifier.count(reminder.ID); calls != attempt {
+			t.Fatalf("reminder retried before its backoff: %d calls after attempt %d", calls, attempt)
+		}
+		clock.Advance(time.Second)
+	}
+
+	clock.Advance(time.Hour)
+	scheduler.RunOnce(context.Background())
+	if calls := notifier.count(reminder.ID); calls != reminderMaxAttempts {
+		t.Fatalf("failed reminder delivered %d times, want %d", calls, reminderMaxAttempts)
+	}
+}
+
+func TestReminderSchedulerSkipsCompletedAndTrashedTasks(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+	clock := &fakeClock{now: time.Now().UTC().Truncate(time.Second)}
+	completed := createDueReminder(t, user, clock.Now().Add(-time.Minute))
+	trashed := createDueReminder(t, user, clock.Now().Add(-time.Minute))
+	if err := db.Model(&Task{}).Where("id = ?", completed.TaskID).Update("completed", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&Task{}, "id = ?", trashed.TaskID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &recordingNotifier{}
+	if sent, err := newTestScheduler(clock, notifier).RunOnce(context.Background()); err != nil || sent != 0 {
+		t.Fatalf("RunOnce = %d, %v; want 0, nil", sent, err)
+	}
+	if notifier.count(completed.ID) != 0 || notifier.count(trashed.ID) != 0 {
+		t.Fatal("reminder of a completed or trashed task was delivered")
+	}
+	if got := loadReminder(t, completed.ID); got.Status != reminderCancelled {
+		t.Errorf("reminder of a completed task: status %q, want cancelled", got.Status)
+	}
+	// Задача в корзине может быть восстановлена, поэтому напоминание ждёт
+	if got := loadReminder(t, trashed.ID); got.Status != reminderPending {
+		t.Errorf("reminder of a trashed task: status %q, want pending", got.Status)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for _, address := range []string{
+		"127.0.0.1", "::1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "::", "fe80::1", "fd00::1", "::ffff:127.0.0.1", "224.0.0.1",
+	} {
+		if isPublicIP(net.ParseIP(address)) {
+			t.Errorf("isPublicIP(%s) = true, want false", address)
+		}
+	}
+	for _, address := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"} {
+		if !isPublicIP(net.ParseIP(address)) {
+			t.Errorf("isPublicIP(%s) = false, want true", address)
+		}
+	}
+}
+
+func TestCheckWebhookTarget(t *testing.T) {
+	for _, target := range []string{"http://127.0.0.1/hook", "http://localhost:8080/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/"} {
+		if err := checkWebhookTarget(context.Background(), target); !errors.Is(err, errWebhookAddress) {
+			t.Errorf("checkWebhookTarget(%q) = %v, want errWebhookAddress", target, err)
+		}
+	}
+	for _, target := range []string{"ftp://example.com/", "example.com", "http:///path"} {
+		if err := checkWebhookTarget(context.Background(), target); err == nil {
+			t.Errorf("checkWebhookTarget(%q) accepted an invalid URL", target)
+		}
+	}
+}
+
+// Адрес проверяется и при отправке: запись DNS могла измениться после создания напоминания
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	called := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+	defer server.Close()
+
+	notifier := webhookNotifier{client: newWebhookClient()}
+	err := notifier.Notify(&Reminder{ID: uuid.New(), Target: server.URL}, &Task{Name: "Задача"}, &User{})
+	if !errors.Is(err, errWebhookAddress) {
+		t.Fatalf("Notify to %s = %v, want errWebhookAddress", server.URL, err)
+	}
+	if called {
+		t.Fatal("webhook reached a loopback server")
+	}
+}
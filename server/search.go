@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// searchConfig — конфигурация текстового поиска Postgres. simple не применяет
+// стемминг, поэтому одинаково работает для русских и английских задач.
+const searchConfig = "simple"
+
+var errEmptySearch = errors.New("Запрос должен содержать хотя бы одно слово без минуса")
+
+// ts_headline отмечает совпадения управляющими символами, которые удаляются из
+// текста задачи заранее; теги <mark> появляются только после экранирования текста.
+const (
+	highlightStart = "\x02"
+	highlightStop  = "\x03"
+)
+
+var highlightMarks = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// renderHighlight превращает результат ts_headline в безопасный HTML
+func renderHighlight(headline string) string {
+	return highlightMarks.Replace(html.EscapeString(headline))
+}
+
+// searchTerm — слово или фраза из поискового запроса
+type searchTerm struct {
+	words   []string
+	prefix  bool
+	negated bool
+}
+
+// parseSearchQuery понимает небольшой синтаксис веб-поиска: слова соединяются
+// через И, "текст в кавычках" — это фраза, * в конце ищет по префиксу, - в начале
+// исключает терм, а OR между термами подходит под любой из них. Результат —
+// список групп; термы внутри группы — альтернативы.
+func parseSearchQuery(q string) ([][]searchTerm, error) {
+	var groups [][]searchTerm
+	pendingOr := false
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		term := searchTerm{}
+		if runes[i] == '-' {
+			term.negated = true
+			i++
+		}
+
+		var text string
+		if i < len(runes) && runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			text = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			text = string(runes[i:end])
+			i = end
+			if text == "OR" && !term.negated {
+				pendingOr = len(groups) > 0
+				continue
+			}
+		}
+		if i < len(runes) && runes[i] == '*' {
+			i++
+			term.prefix = true
+		}
+		if strings.HasSuffix(text, "*") {
+			term.prefix = true
+		}
+
+		term.words = strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if len(term.words) == 0 {
+			pendingOr = false
+			continue
+		}
+
+		last := len(groups) - 1
+		if pendingOr && !term.negated && !groups[last][0].negated {
+			groups[last] = append(groups[last], term)
+		} else {
+			groups = append(groups, []searchTerm{term})
+		}
+		pendingOr = false
+	}
+
+	for _, group := range groups {
+		if !group[0].negated {
+			return groups, nil
+		}
+	}
+	return nil, errEmptySearch
+}
+
+// toTSQuery рендерит запрос в синтаксис to_tsquery. Слова содержат только буквы и цифры,
+// поэтому кавычки внутри лексем невозможны.
+func toTSQuery(groups [][]searchTerm) string {
+	parts := make([]string, len(groups))
+	for i, group := range groups {
+		alternatives := make([]string, len(group))
+		for j, term := range group {
+			lexemes := make([]string, len(term.words))
+			for k, word := range term.words {
+				lexemes[k] = "'" + word + "'"
+			}
+			if term.prefix {
+				lexemes[len(lexemes)-1] += ":*"
+			}
+			alternatives[j] = "(" + strings.Join(lexemes, " <-> ") + ")"
+			if term.negated {
+				alternatives[j] = "!" + alternatives[j]
+			}
+		}
+		parts[i] = strings.Join(alternatives, " | ")
+		if len(alternatives) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// setupTaskSearch создаёт колонку и индекс полнотекстового поиска. Вызывается после AutoMigrate.
+func setupTaskSearch() error {
+	statements := []string{
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+			setweight(to_tsvector('simple', coalesce(details, '')), 'B')) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN (search_vector)`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TaskSearchResult — найденная задача. NameHighlight и Snippet — экранированный
+// HTML, в котором совпадения обёрнуты в <mark>.
+type TaskSearchResult struct {
+	Task          Task    `json:"task"`
+	Rank          float64 `json:"rank"`
+	NameHighlight string  `json:"nameHighlight"`
+	Snippet       string  `json:"snippet"`
+}
+
+type searchHit struct {
+	ID            uuid.UUID
+	Rank          float64
+	NameHighlight string
+	Snippet       string
+}
+
+// SearchTasks ищет задачи по названию и описанию. Поиск построен на tsvector и
+// работает только с Postgres: сервер не подключается к другим базам.
+func SearchTasks(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	groups, err := parseSearchQuery(c.Query("q"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > maxTaskPageSize {
+		limit = 20
+	}
+
+	var hits []searchHit
+	const marks = "StartSel=" + highlightStart + ", StopSel=" + highlightStop
+	err = db.Table("tasks").Scopes(taskScope(principal.UserId)).
+		Select(`tasks.id, ts_rank_cd(tasks.search_vector, q) AS rank,
+			ts_headline(?, translate(tasks.name, ?, ''), q, ?) AS name_highlight,
+			ts_headline(?, translate(coalesce(tasks.details, ''), ?, ''), q, ?) AS snippet`,
+			searchConfig, highlightStart+highlightStop, marks+", HighlightAll=true",
+			searchConfig, highlightStart+highlightStop, marks+", MaxFragments=2, MaxWords=20, MinWords=5").
+		Joins("CROSS JOIN to_tsquery(?, ?) AS q", searchConfig, toTSQuery(groups)).
+		Where("tasks.search_vector @@ q AND tasks.deleted_at IS NULL").
+		Order("rank DESC, tasks.id").Limit(limit).Scan(&hits).Error
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "searchTasks",
+			"error":  err.Error(),
+		}).Error("Error searching tasks")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка поиска задач"})
+		return
+	}
+
+	ids := make([]uuid.UUID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var tasks []Task
+	if len(ids) > 0 {
+		if err := db.Scopes(taskScope(principal.UserId)).Preload("Tags").Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка поиска задач"})
+			return
+		}
+	}
+	byID := make(map[uuid.UUID]Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	results := []TaskSearchResult{}
+	for _, hit := range hits {
+		task, found := byID[hit.ID]
+		if !found {
+			continue
+		}
+		results = append(results, TaskSearchResult{
+			Task:          task,
+			Rank:          hit.Rank,
+			NameHighlight: renderHighlight(hit.NameHighlight),
+			Snippet:       renderHighlight(hit.Snippet),
+		})
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":  "searchTasks",
+		"results": len(results),
+	}).Info("SearchTasks executed successfully")
+
+	c.JSON(http.StatusOK, results)
+}
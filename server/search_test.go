@@ -0,0 +1,15 @@
+package main
+
+import "testing"
+
+func TestRenderHighlightEscapesTaskText(t *testing.T) {
+	for _, tc := range []struct{ headline, want string }{
+		{"купить \x02молоко\x03", "купить <mark>молоко</mark>"},
+		{"\x02<script>\x03alert(1)</script>", "<mark>&lt;script&gt;</mark>alert(1)&lt;/script&gt;"},
+		{"<img src=x onerror=\"alert(1)\"> & \x02tag\x03", "&lt;img src=x onerror=&#34;alert(1)&#34;&gt; &amp; <mark>tag</mark>"},
+	} {
+		if got := renderHighlight(tc.headline); got != tc.want {
+			t.Errorf("renderHighlight(%q) = %q, want %q", tc.headline, got, tc.want)
+		}
+	}
+}
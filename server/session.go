@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+var (
+	accessTokenExpiresIn  = 15 * time.Minute
+	refreshTokenExpiresIn = 30 * 24 * time.Hour
+)
+
+var errSessionRevoked = errors.New("Session has been revoked")
+
+// Session — вход пользователя на одном устройстве. Refresh-токен хранится только
+// в виде хэша и меняется при каждом обновлении; предыдущий хэш сохраняется, чтобы
+// распознать повторное использование украденного токена.
+type Session struct {
+	ID                uuid.UUID  `gorm:"primaryKey" json:"id"`
+	UserId            uint       `json:"userId" gorm:"index"`
+	RefreshTokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	PreviousTokenHash string     `json:"-" gorm:"index"`
+	UserAgent         string     `json:"userAgent"`
+	IP                string     `json:"ip"`
+	CreatedDate       time.Time  `json:"createdDate"`
+	LastUsedAt        time.Time  `json:"lastUsedAt"`
+	ExpiresAt         time.Time  `json:"expiresAt"`
+	RevokedAt         *time.Time `json:"revokedAt"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newSecretToken возвращает случайный токен для refresh-токенов и ссылок из писем
+func newSecretToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// activeSessions — действующие сессии; используется и при проверке каждого запроса
+func activeSessions(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Model(&Session{}).Where("revoked_at IS NULL AND expires_at > ?", now)
+}
+
+// checkSession проверяет, не отозвана ли сессия, за каждым access-токеном.
+func checkSession(sessionID uuid.UUID, userId uint) error {
+	var count int64
+	if err := activeSessions(db, time.Now()).Where("id = ? AND user_id = ?", sessionID, userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errSessionRevoked
+	}
+	return nil
+}
+
+// revokeUserSessions завершает все сессии пользователя, кроме except (uuid.Nil — все)
+func revokeUserSessions(tx *gorm.DB, userId uint, except uuid.UUID) (int64, error) {
+	result := tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL AND id <> ?", userId, except).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// issueTokens начинает новую сессию пользователя и выдаёт пару токенов
+func issueTokens(c *gin.Context, user *User) (*TokenResponse, error) {
+	refreshToken, err := newSecretToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := Session{
+		ID:               uuid.New(),
+		UserId:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        c.Request.UserAgent(),
+		IP:               c.ClientIP(),
+		CreatedDate:      now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(refreshTokenExpiresIn),
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Истёкшие сессии больше не нужны
+		if err := tx.Where("user_id = ? AND expires_at < ?", user.ID, now).Delete(&Session{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&session).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	token, err := GenerateToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{Token: token, RefreshToken: refreshToken, ExpiresIn: int(accessTokenExpiresIn.Seconds())}, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов. Старый refresh-токен
+// перестаёт действовать; его повторное предъявление завершает сессию целиком.
+func Refresh(c *gin.Context) {
+	var request RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	hash := hashToken(request.RefreshToken)
+	now := time.Now()
+
+	var session Session
+	if err := activeSessions(db, now).Where("refresh_token_hash = ?", hash).First(&session).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+			return
+		}
+		// Токен уже был обменян: кто-то использует его повторно
+		var reused Session
+		if db.Where("previous_token_hash = ? AND revoked_at IS NULL", hash).First(&reused).Error == nil {
+			db.Model(&reused).Update("revoked_at", now)
+			log.WithFields(logrus.Fields{
+				"action":    "refresh",
+				"userId":    reused.UserId,
+				"sessionId": reused.ID,
+			}).Warn("Refresh token reuse detected, session revoked")
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	var user User
+	if err := db.First(&user, session.UserId).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	refreshToken, err := newSecretToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	// Условие на текущий хэш не даёт двум параллельным запросам обменять один токен дважды
+	result := db.Model(&Session{}).Where("id = ? AND refresh_token_hash = ?", session.ID, hash).Updates(map[string]interface{}{
+		"refresh_token_hash":  hashToken(refreshToken),
+		"previous_token_hash": hash,
+		"last_used_at":        now,
+		"expires_at":          now.Add(refreshTokenExpiresIn),
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	token, err := GenerateToken(&user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, TokenResponse{Token: token, RefreshToken: refreshToken, ExpiresIn: int(accessTokenExpiresIn.Seconds())})
+}
+
+// Logout завершает текущую сессию; её access-токен перестаёт действовать сразу.
+func Logout(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	if err := db.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", principal.SessionID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":    "logout",
+		"userId":    principal.UserId,
+		"sessionId": principal.SessionID,
+	}).Info("User logged out")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll завершает все сессии пользователя, включая текущую.
+func LogoutAll(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	revoked, err := revokeUserSessions(db, principal.UserId, uuid.Nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":  "logoutAll",
+		"userId":  principal.UserId,
+		"revoked": revoked,
+	}).Info("User logged out on all devices")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out on all devices", "revoked": revoked})
+}
+
+func GetSessions(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	var sessions []Session
+	if err := activeSessions(db, time.Now()).Where("user_id = ?", principal.UserId).
+		Order("last_used_at DESC").Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sessions"})
+		return
+	}
+	response := make([]gin.H, len(sessions))
+	for i, session := range sessions {
+		response[i] = gin.H{
+			"id":          session.ID,
+			"userAgent":   session.UserAgent,
+			"ip":          session.IP,
+			"createdDate": session.CreatedDate,
+			"lastUsedAt":  session.LastUsedAt,
+			"current":     session.ID == principal.SessionID,
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RevokeSession(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+	result := db.Model(&Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, principal.UserId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
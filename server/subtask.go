@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"time"
+)
+
+type TaskProgress struct {
+	Total     int64 `json:"total"`
+	Completed int64 `json:"completed"`
+	Percent   int   `json:"percent"`
+}
+
+// subtreeCTE обходит только задачи вне корзины: сырой SQL не получает условие мягкого удаления от gorm.
+// UNION вместо UNION ALL останавливает обход, даже если в данных оказался цикл.
+const subtreeCTE = `WITH RECURSIVE subtree AS (
+	SELECT id FROM tasks WHERE parent_id = ? AND deleted_at IS NULL
+	UNION
+	SELECT tasks.id FROM tasks JOIN subtree ON tasks.parent_id = subtree.id WHERE tasks.deleted_at IS NULL
+)`
+
+// descendantIDs возвращает идентификаторы всех подзадач на любой глубине
+func descendantIDs(tx *gorm.DB, taskID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := tx.Raw(subtreeCTE+" SELECT id FROM subtree", taskID).Scan(&ids).Error
+	return ids, err
+}
+
+// moveSubtreeToProject переносит все подзадачи в проект корневой задачи:
+// подзадача всегда находится в проекте своего родителя.
+func moveSubtreeToProject(tx *gorm.DB, taskID uuid.UUID, projectID *uuid.UUID, now time.Time) error {
+	descendants, err := descendantIDs(tx, taskID)
+	if err != nil || len(descendants) == 0 {
+		return err
+	}
+	return tx.Model(&Task{}).Where("id IN ?", descendants).
+		Updates(map[string]interface{}{"project_id": projectID, "lastupdated": now, "version": gorm.Expr("version + 1")}).Error
+}
+
+// lockParentChain блокирует перемещаемую задачу и нового родителя (в порядке id,
+// чтобы встречные перемещения не взаимоблокировались), затем цепочку предков
+// родителя, и проверяет, что задачи в этой цепочке нет. Проверка по данным,
+// прочитанным до транзакции, пропустила бы встречные «A под B» и «B под A».
+// Возвращает проект родителя на момент блокировки.
+func lockParentChain(tx *gorm.DB, taskID, parentID uuid.UUID) (*uuid.UUID, error) {
+	locked := tx.Unscoped().Model(&Task{}).Clauses(clause.Locking{Strength: "UPDATE"})
+	first, second := taskID, parentID
+	if bytes.Compare(first[:], second[:]) > 0 {
+		first, second = second, first
+	}
+	for _, id := range []uuid.UUID{first, second} {
+		var found []uuid.UUID
+		if err := locked.Session(&gorm.Session{}).Where("id = ?", id).Pluck("id", &found).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var projectID *uuid.UUID
+	visited := map[uuid.UUID]bool{}
+	for id := &parentID; id != nil && !visited[*id]; {
+		if *id == taskID {
+			return nil, &requestError{http.StatusBadRequest, "Нельзя переместить задачу внутрь её собственной подзадачи"}
+		}
+		visited[*id] = true
+		var ancestor Task
+		if err := locked.Session(&gorm.Session{}).Select("id", "parent_id", "project_id").First(&ancestor, "id = ?", *id).Error; err != nil {
+			return nil, err
+		}
+		if *id == parentID {
+			projectID = ancestor.ProjectID
+		}
+		id = ancestor.ParentID
+	}
+	return projectID, nil
+}
+
+// taskProgress считает выполненные задачи среди всех потомков задачи.
+// Для задач без подзадач возвращает nil.
+func taskProgress(taskID uuid.UUID) (*TaskProgress, error) {
+	var progress TaskProgress
+	err := db.Raw(subtreeCTE+` SELECT COUNT(*) AS total, COALESCE(SUM(CASE WHEN completed THEN 1 ELSE 0 END), 0) AS completed
+		FROM tasks WHERE id IN (SELECT id FROM subtree)`, taskID).Scan(&progress).Error
+	if err != nil || progress.Total == 0 {
+		return nil, err
+	}
+	progress.Percent = int(progress.Completed * 100 / progress.Total)
+	return &progress, nil
+}
+
+// deleteTaskTree перемещает задачу в корзину и, в зависимости от режима, её подзадачи:
+// cascade удаляет всё поддерево, promote поднимает прямых потомков на уровень удаляемой задачи.
+// Всё поддерево удаляется одним запросом, поэтому получает одинаковый deleted_at и восстанавливается вместе.
+// Теги и напоминания остаются до окончательной очистки корзины.
+func deleteTaskTree(tx *gorm.DB, task *Task, mode string) error {
+	ids := []uuid.UUID{task.ID}
+	if mode == "promote" {
+		var children []uuid.UUID
+		if err := tx.Model(&Task{}).Where("parent_id = ?", task.ID).
+			Order("position = ''").Order("position").Order("created_date").Pluck("id", &children).Error; err != nil {
+			return err
+		}
+		// Потомки встают в конец списка, в который поднимаются, в прежнем порядке:
+		// позиции из списка удаляемой задачи смешались бы с позициями соседей
+		list := taskListOf(&Task{UserId: task.UserId, ProjectID: task.ProjectID, ParentID: task.ParentID})
+		now := time.Now()
+		for _, id := range children {
+			position, err := appendPosition(tx, list)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&Task{}).Where("id = ?", id).Updates(map[string]interface{}{
+				"parent_id":   task.ParentID,
+				"position":    position,
+				"lastupdated": now,
+				"version":     gorm.Expr("version + 1"),
+			}).Error; err != nil {
+				return err
+			}
+		}
+	} else {
+		descendants, err := descendantIDs(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, descendants...)
+	}
+
+	return tx.Where("id IN ?", ids).Delete(&Task{}).Error
+}
+
+func GetTaskChildren(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	parent, principal, ok := findUserTask(c, "getTaskChildren", db)
+	if !ok {
+		return
+	}
+
+	var children []Task
+	err := db.Scopes(taskScope(principal.UserId)).Preload("Tags").Where("parent_id = ?", parent.ID).Order("created_date").Find(&children).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения подзадач"})
+		return
+	}
+
+	loc := userLocation(principal.UserId)
+	now := time.Now()
+	for i := range children {
+		children[i].Overdue = children[i].IsOverdue(now, loc)
+		if children[i].Progress, err = taskProgress(children[i].ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения подзадач"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, children)
+}
+
+// MoveTask переносит задачу вместе с поддеревом под другого родителя (parentId: null — на верхний уровень).
+// Поддерево получает проект нового родителя.
+func MoveTask(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var request struct {
+		ParentID *uuid.UUID `json:"parentId"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+
+	task, principal, ok := findUserTask(c, "moveTask", db)
+	if !ok {
+		return
+	}
+
+	projectID := task.ProjectID
+	if request.ParentID != nil {
+		if *request.ParentID == task.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Задача не может быть родителем самой себя"})
+			return
+		}
+		var parent Task
+		if err := db.Scopes(taskScope(principal.UserId)).First(&parent, "id = ?", *request.ParentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Родительская задача не найдена"})
+			return
+		}
+	}
+
+	now := time.Now()
+	before := snapshotOf(&task)
+	var position string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if request.ParentID != nil {
+			if projectID, err = lockParentChain(tx, task.ID, *request.ParentID); err != nil {
+				return err
+			}
+		}
+		// В новом списке задача встаёт в конец
+		position, err = appendPosition(tx, taskList{UserId: task.UserId, ProjectID: projectID, ParentID: request.ParentID})
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&Task{}).Where("id = ? AND version = ?", task.ID, task.Version).Updates(map[string]interface{}{
+			"parent_id":   request.ParentID,
+			"project_id":  projectID,
+			"position":    position,
+			"lastupdated": now,
+			"version":     gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errTaskVersionConflict
+		}
+		moved := task
+		moved.ParentID, moved.ProjectID = request.ParentID, projectID
+		if err := recordRevision(tx, &moved, &before, principal.UserId, "move", nil); err != nil {
+			return err
+		}
+		return moveSubtreeToProject(tx, task.ID, projectID, now)
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondVersionConflict(c, &task, http.StatusConflict)
+		return
+	}
+	if _, ok := err.(*requestError); ok {
+		respondRequestError(c, err)
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "moveTask",
+			"error":  err.Error(),
+		}).Error("Error moving task subtree")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка перемещения задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":   "moveTask",
+		"taskID":   task.ID,
+		"parentID": request.ParentID,
+	}).Info("Task moved successfully")
+
+	task.ParentID = request.ParentID
+	task.ProjectID = projectID
+	task.Position = position
+	task.LastUpdated = now
+	task.Version++
+	c.Header("ETag", taskETag(&task))
+	c.JSON(http.StatusOK, task)
+}
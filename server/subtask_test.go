@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func moveRequest(taskID, parentID fmt.Stringer) (string, string) {
+	return "/api/tasks/" + taskID.String() + "/move", fmt.Sprintf(`{"parentId":%q}`, parentID)
+}
+
+// Встречные перемещения «A под B» и «B под A» не должны замкнуть цикл
+func TestMoveTaskRejectsConcurrentCycles(t *testing.T) {
+	setupTestDB(t)
+	router := newRouter()
+	user := createTestUser(t, "alice")
+	authorization := authHeader(t, user)
+
+	for round := 0; round < 10; round++ {
+		a := createTestTask(t, user.ID, Task{Name: "A"})
+		b := createTestTask(t, user.ID, Task{Name: "B"})
+
+		codes := make([]int, 2)
+		var wg sync.WaitGroup
+		for i, pair := range [][2]*Task{{a, b}, {b, a}} {
+			wg.Add(1)
+			go func(i int, task, parent *Task) {
+				defer wg.Done()
+				path, body := moveRequest(task.ID, parent.ID)
+				codes[i] = performRequest(router, http.MethodPut, path, body, authorization).Code
+			}(i, pair[0], pair[1])
+		}
+		wg.Wait()
+
+		var moved []Task
+		db.Where("id IN ? AND parent_id IS NOT NULL", []interface{}{a.ID, b.ID}).Find(&moved)
+		if len(moved) != 1 {
+			t.Fatalf("round %d: %d of the two tasks have a parent (statuses %v), want exactly one", round, len(moved), codes)
+		}
+		if !(codes[0] == http.StatusOK && codes[1] == http.StatusBadRequest) && !(codes[0] == http.StatusBadRequest && codes[1] == http.StatusOK) {
+			t.Fatalf("round %d: statuses %v, want one 200 and one 400", round, codes)
+		}
+	}
+}
+
+func TestMoveTaskRejectsMoveUnderDescendant(t *testing.T) {
+	setupTestDB(t)
+	router := newRouter()
+	user := createTestUser(t, "alice")
+	authorization := authHeader(t, user)
+	root := createTestTask(t, user.ID, Task{Name: "Корень"})
+	child := createTestTask(t, user.ID, Task{Name: "Подзадача", ParentID: &root.ID})
+	grandchild := createTestTask(t, user.ID, Task{Name: "Вложенная", ParentID: &child.ID})
+
+	path, body := moveRequest(root.ID, grandchild.ID)
+	if response := performRequest(router, http.MethodPut, path, body, authorization); response.Code != http.StatusBadRequest {
+		t.Fatalf("move under a grandchild: status = %d, want 400; body: %s", response.Code, response.Body)
+	}
+}
+
+// Поднятые подзадачи встают в конец нового списка в прежнем порядке
+func TestDeleteTaskPromoteAppendsChildren(t *testing.T) {
+	setupTestDB(t)
+	router := newRouter()
+	user := createTestUser(t, "alice")
+	first := createTestTask(t, user.ID, Task{Name: "Первая"})
+	parent := createTestTask(t, user.ID, Task{Name: "Родитель"})
+	last := createTestTask(t, user.ID, Task{Name: "Последняя"})
+	childA := createTestTask(t, user.ID, Task{Name: "Подзадача A", ParentID: &parent.ID})
+	childB := createTestTask(t, user.ID, Task{Name: "Подзадача B", ParentID: &parent.ID})
+
+	response := performRequest(router, http.MethodDelete, "/api/tasks/"+parent.ID.String()+"?children=promote", "", authHeader(t, user))
+	if response.Code != http.StatusOK && response.Code != http.StatusNoContent {
+		t.Fatalf("delete: status = %d; body: %s", response.Code, response.Body)
+	}
+
+	var order []string
+	db.Model(&Task{}).Where("user_id = ? AND parent_id IS NULL", user.ID).Order("position").Pluck("name", &order)
+	want := []string{first.Name, last.Name, childA.Name, childB.Name}
+	if fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Fatalf("root list order = %v, want %v", order, want)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Tag struct {
+	ID          uuid.UUID `gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex:idx_tags_user_name"`
+	Color       string    `json:"color"`
+	UserId      uint      `json:"userId" gorm:"uniqueIndex:idx_tags_user_name"`
+	CreatedDate time.Time `json:"createdDate"`
+}
+
+// splitTagNames разбирает параметр tags=a,b, отбрасывая пустые и повторяющиеся имена
+func splitTagNames(value string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// taggedTaskIDs возвращает подзапрос с ID задач пользователя, у которых есть
+// любой (matchAll == false) или все (matchAll == true) из указанных тегов.
+func taggedTaskIDs(userId uint, names []string, matchAll bool) *gorm.DB {
+	query := db.Table("task_tags").
+		Select("task_tags.task_id").
+		Joins("JOIN tags ON tags.id = task_tags.tag_id").
+		Where("tags.user_id = ? AND tags.name IN ?", userId, names)
+	if matchAll {
+		query = query.Group("task_tags.task_id").Having("COUNT(DISTINCT tags.id) = ?", len(names))
+	}
+	return query
+}
+
+func findUserTag(c *gin.Context, action string, param string) (Tag, bool) {
+	var tag Tag
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return tag, false
+	}
+
+	tagID, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error parsing tag ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор тега"})
+		return tag, false
+	}
+
+	if err := db.First(&tag, "id = ? AND user_id = ?", tagID, principal.UserId).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error retrieving tag")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Тег не найден"})
+		return tag, false
+	}
+	return tag, true
+}
+
+func tagNameTaken(userId uint, name string, exceptID uuid.UUID) bool {
+	var count int64
+	db.Model(&Tag{}).Where("user_id = ? AND name = ? AND id <> ?", userId, name, exceptID).Count(&count)
+	return count > 0
+}
+
+func GetTags(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var tags []Tag
+	if err := db.Where("user_id = ?", principal.UserId).Order("name").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения тегов"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func CreateTag(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var newTag Tag
+	if err := c.BindJSON(&newTag); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createTag",
+			"error":  err.Error(),
+		}).Error("Error binding JSON for creating tag")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	newTag.Name = strings.TrimSpace(newTag.Name)
+	if newTag.Name == "" || strings.Contains(newTag.Name, ",") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название тега обязательно и не может содержать запятую"})
+		return
+	}
+
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	if tagNameTaken(principal.UserId, newTag.Name, uuid.Nil) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Тег с таким названием уже существует"})
+		return
+	}
+	newTag.ID = uuid.New()
+	newTag.UserId = principal.UserId
+	newTag.CreatedDate = time.Now()
+
+	if err := db.Create(&newTag).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createTag",
+			"error":  err.Error(),
+		}).Error("Error creating tag in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания тега"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "createTag",
+		"tagID":  newTag.ID,
+	}).Info("Tag created successfully")
+
+	c.JSON(http.StatusCreated, newTag)
+}
+
+// UpdateTag переименовывает тег и/или меняет его цвет
+func UpdateTag(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	tag, ok := findUserTag(c, "updateTag", "id")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "updateTag",
+			"error":  err.Error(),
+		}).Error("Error binding JSON for updating tag")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || strings.Contains(request.Name, ",") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название тега обязательно и не может содержать запятую"})
+		return
+	}
+	if tagNameTaken(tag.UserId, request.Name, tag.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Тег с таким названием уже существует, используйте объединение"})
+		return
+	}
+
+	tag.Name = request.Name
+	tag.Color = request.Color
+
+	if err := db.Save(&tag).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "updateTag",
+			"error":  err.Error(),
+		}).Error("Error updating tag in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления тега"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "updateTag",
+		"tagID":  tag.ID,
+	}).Info("Tag updated successfully")
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// MergeTag переносит все задачи тега :id на тег into и удаляет исходный тег
+func MergeTag(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	source, ok := findUserTag(c, "mergeTag", "id")
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Into uuid.UUID `json:"into"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	if request.Into == source.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Нельзя объединить тег с самим собой"})
+		return
+	}
+
+	var target Tag
+	if err := db.First(&target, "id = ? AND user_id = ?", request.Into, source.UserId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Тег не найден"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("INSERT INTO task_tags (task_id, tag_id) SELECT task_id, ? FROM task_tags WHERE tag_id = ? ON CONFLICT DO NOTHING",
+			target.ID, source.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", source.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&source).Error
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "mergeTag",
+			"error":  err.Error(),
+		}).Error("Error merging tags")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка объединения тегов"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "mergeTag",
+		"from":   source.ID,
+		"into":   target.ID,
+	}).Info("Tags merged successfully")
+
+	c.JSON(http.StatusOK, target)
+}
+
+func DeleteTag(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	tag, ok := findUserTag(c, "deleteTag", "id")
+	if !ok {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "deleteTag",
+			"error":  err.Error(),
+		}).Error("Error deleting tag from the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления тега"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "deleteTag",
+		"tagID":  tag.ID,
+	}).Info("Tag deleted successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Тег успешно удален"})
+}
+
+func AttachTag(c *gin.Context) {
+	changeTaskTag(c, "attachTag", true)
+}
+
+func DetachTag(c *gin.Context) {
+	changeTaskTag(c, "detachTag", false)
+}
+
+func changeTaskTag(c *gin.Context, action string, attach bool) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, _, ok := findUserTask(c, action, db)
+	if !ok {
+		return
+	}
+	tag, ok := findUserTag(c, action, "tagId")
+	if !ok {
+		return
+	}
+
+	var err error
+	association := db.Model(&task).Association("Tags")
+	if attach {
+		err = association.Append(&tag)
+	} else {
+		err = association.Delete(&tag)
+	}
+	if err == nil {
+		err = db.Model(&task).Update("lastupdated", time.Now()).Error
+	}
+	if err == nil {
+		err = db.Preload("Tags").First(&task, "id = ?", task.ID).Error
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error changing task tags")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": action,
+		"taskID": task.ID,
+		"tagID":  tag.ID,
+	}).Info("Task tags changed successfully")
+
+	c.JSON(http.StatusOK, task)
+}
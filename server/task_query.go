@@ -0,0 +1,548 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type taskSortField struct {
+	column   string
+	nullable bool
+	numeric  bool
+	// value извлекает значение поля из задачи для курсора постраничной выдачи
+	value func(t *Task) interface{}
+}
+
+// taskSortFields — поля, по которым разрешена сортировка GetTasks.
+// В SQL попадают только значения из этой таблицы, но никогда не параметры запроса.
+var taskSortFields = map[string]taskSortField{
+	"id":          {column: "id", value: func(t *Task) interface{} { return t.ID.String() }},
+	"name":        {column: "name", value: func(t *Task) interface{} { return t.Name }},
+	"details":     {column: "details", value: func(t *Task) interface{} { return t.Details }},
+	"createdDate": {column: "created_date", value: func(t *Task) interface{} { return t.CreatedDate }},
+	"lastUpdated": {column: "lastupdated", value: func(t *Task) interface{} { return t.LastUpdated }},
+	"star":        {column: "have_star", value: func(t *Task) interface{} { return t.HaveStar }},
+	"priority":    {column: "priority", nullable: true, numeric: true, value: func(t *Task) interface{} { return intOrNil(t.Priority) }},
+	"dueAt":       {column: "due_at", nullable: true, value: func(t *Task) interface{} { return timeOrNil(t.DueAt) }},
+	"completed":   {column: "completed", value: func(t *Task) interface{} { return t.Completed }},
+	"completedAt": {column: "completed_at", nullable: true, value: func(t *Task) interface{} { return timeOrNil(t.CompletedAt) }},
+	"position":    {column: "position", value: func(t *Task) interface{} { return t.Position }},
+}
+
+func intOrNil(n *int) interface{} {
+	if n == nil {
+		return nil
+	}
+	return *n
+}
+
+func timeOrNil(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// queryError — ответ 400 на неверные параметры списка. Allowed, если задан,
+// перечисляет допустимые значения параметра.
+type queryError struct {
+	message string
+	allowed []string
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+func respondQueryError(c *gin.Context, err error) {
+	response := gin.H{"error": err.Error()}
+	var allowed []string
+	switch qe := err.(type) {
+	case *queryError:
+		allowed = qe.allowed
+	case *querySyntaxError:
+		response["error"] = qe.message
+		response["position"] = qe.pos
+		allowed = qe.allowed
+	}
+	if len(allowed) > 0 {
+		response["allowed"] = allowed
+	}
+	c.JSON(http.StatusBadRequest, response)
+}
+
+func sortableTaskFields() []string {
+	fields := make([]string, 0, len(taskSortFields))
+	for name := range taskSortFields {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+type taskOrder struct {
+	field string
+	desc  bool
+}
+
+// parseTaskSort разбирает sort=-star,dueAt,name (минус — по убыванию).
+// Старые параметры sortField/sortOrder поддерживаются, если sort не задан.
+func parseTaskSort(value, legacyField, legacyOrder string) ([]taskOrder, error) {
+	if value == "" && legacyField != "" {
+		switch strings.ToLower(legacyOrder) {
+		case "", "asc":
+			value = legacyField
+		case "desc":
+			value = "-" + legacyField
+		default:
+			return nil, &queryError{message: "Неверное направление сортировки", allowed: []string{"asc", "desc"}}
+		}
+	}
+
+	var orders []taskOrder
+	seen := map[string]bool{}
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		order := taskOrder{field: key}
+		if strings.HasPrefix(key, "-") {
+			order = taskOrder{field: key[1:], desc: true}
+		} else if strings.HasPrefix(key, "+") {
+			order.field = key[1:]
+		}
+		if order.field == "ID" {
+			order.field = "id" // старый клиент передавал sortField=ID
+		}
+		if _, ok := taskSortFields[order.field]; !ok {
+			return nil, &queryError{message: fmt.Sprintf("Неизвестное поле сортировки %q", order.field), allowed: sortableTaskFields()}
+		}
+		if seen[order.field] {
+			continue
+		}
+		seen[order.field] = true
+		orders = append(orders, order)
+	}
+	if !seen["id"] {
+		// id делает порядок детерминированным при равных значениях
+		orders = append(orders, taskOrder{field: "id"})
+	}
+	return orders, nil
+}
+
+func orderTasks(query *gorm.DB, orders []taskOrder) *gorm.DB {
+	for _, order := range orders {
+		field := taskSortFields[order.field]
+		direction := " ASC"
+		if order.desc {
+			direction = " DESC"
+		}
+		if field.nullable {
+			// Задачи без значения всегда в конце списка
+			query = query.Order(field.column + " IS NULL")
+		}
+		query = query.Order(field.column + direction)
+	}
+	return query
+}
+
+type timeRange struct {
+	after  *time.Time
+	before *time.Time
+}
+
+type taskFilter struct {
+	name            string
+	details         string
+	star            bool
+	priorities      []int
+	noPriority      bool
+	status          string
+	overdue         *bool
+	hasDue          *bool
+	recurring       *bool
+	projectID       *uuid.UUID
+	inbox           bool
+	includeArchived bool
+	parentID        *uuid.UUID
+	rootOnly        bool
+	tags            []string
+	matchAllTags    bool
+	due             timeRange
+	created         timeRange
+	updated         timeRange
+	completed       timeRange
+}
+
+func parseBoolParam(c *gin.Context, name string) (*bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, &queryError{message: fmt.Sprintf("Неверное значение %s", name), allowed: []string{"true", "false"}}
+	}
+	return &b, nil
+}
+
+func parseTimeRange(c *gin.Context, prefix string, loc *time.Location) (timeRange, error) {
+	var r timeRange
+	for _, bound := range []string{"After", "Before"} {
+		name := prefix + bound
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		t, err := parseTimeParam(value, loc)
+		if err != nil {
+			return r, &queryError{message: fmt.Sprintf("Неверный формат даты %s: ожидается RFC 3339 или YYYY-MM-DD", name)}
+		}
+		if bound == "After" {
+			r.after = &t
+		} else {
+			r.before = &t
+		}
+	}
+	return r, nil
+}
+
+func parseTaskFilter(c *gin.Context, loc *time.Location) (*taskFilter, error) {
+	f := &taskFilter{
+		name:    c.Query("name"),
+		details: c.Query("details"),
+		status:  c.DefaultQuery("status", "open"),
+	}
+
+	// star=false исторически означает «без фильтра»: клиент всегда передаёт этот параметр.
+	// Устарело: избранное отдаёт GET /api/lists/starred, параметр оставлен для старого клиента.
+	star, err := parseBoolParam(c, "star")
+	if err != nil {
+		return nil, err
+	}
+	f.star = star != nil && *star
+	// priority=1,2 или priority=none
+	for _, value := range strings.Split(c.Query("priority"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if strings.ToLower(value) == "none" {
+			f.noPriority = true
+			continue
+		}
+		priority, ok := parsePriority(value)
+		if !ok {
+			return nil, &queryError{message: "Неверное значение priority", allowed: priorityValues()}
+		}
+		f.priorities = append(f.priorities, priority)
+	}
+	if f.overdue, err = parseBoolParam(c, "overdue"); err != nil {
+		return nil, err
+	}
+	if f.hasDue, err = parseBoolParam(c, "hasDue"); err != nil {
+		return nil, err
+	}
+	if f.recurring, err = parseBoolParam(c, "recurring"); err != nil {
+		return nil, err
+	}
+	includeArchived, err := parseBoolParam(c, "includeArchived")
+	if err != nil {
+		return nil, err
+	}
+	f.includeArchived = includeArchived != nil && *includeArchived
+
+	if f.status != "open" && f.status != "completed" && f.status != "all" {
+		return nil, &queryError{message: "Неверный статус", allowed: []string{"open", "completed", "all"}}
+	}
+
+	switch projectFilter := c.Query("projectId"); projectFilter {
+	case "":
+	case "none":
+		f.inbox = true
+	default:
+		projectID, err := uuid.Parse(projectFilter)
+		if err != nil {
+			return nil, &queryError{message: "Неверный идентификатор проекта"}
+		}
+		f.projectID = &projectID
+	}
+
+	switch parentFilter := c.Query("parentId"); parentFilter {
+	case "":
+	case "root":
+		f.rootOnly = true
+	default:
+		parentID, err := uuid.Parse(parentFilter)
+		if err != nil {
+			return nil, &queryError{message: "Неверный идентификатор родительской задачи"}
+		}
+		f.parentID = &parentID
+	}
+
+	f.tags = splitTagNames(c.Query("tags"))
+	switch c.DefaultQuery("tagMode", "any") {
+	case "any":
+	case "all":
+		f.matchAllTags = true
+	default:
+		return nil, &queryError{message: "Неверное значение tagMode", allowed: []string{"any", "all"}}
+	}
+
+	if f.due, err = parseTimeRange(c, "due", loc); err != nil {
+		return nil, err
+	}
+	if f.created, err = parseTimeRange(c, "created", loc); err != nil {
+		return nil, err
+	}
+	if f.updated, err = parseTimeRange(c, "updated", loc); err != nil {
+		return nil, err
+	}
+	if f.completed, err = parseTimeRange(c, "completed", loc); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func applyTimeRange(query *gorm.DB, column string, r timeRange) *gorm.DB {
+	if r.after != nil {
+		query = query.Where(column+" >= ?", *r.after)
+	}
+	if r.before != nil {
+		query = query.Where(column+" < ?", *r.before)
+	}
+	return query
+}
+
+// overdueCondition: задача без времени просрочена только после окончания дня срока
+const overdueCondition = "NOT completed AND due_at IS NOT NULL AND ((due_has_time AND due_at < ?) OR (NOT due_has_time AND due_at < ?))"
+
+func (f *taskFilter) apply(query *gorm.DB, userId uint, now time.Time, loc *time.Location) *gorm.DB {
+	if f.name != "" {
+		query = query.Where("name LIKE ?", "%"+f.name+"%")
+	}
+	if f.details != "" {
+		query = query.Where("details LIKE ?", "%"+f.details+"%")
+	}
+	if f.star {
+		query = query.Where("have_star = ?", true)
+	}
+	switch {
+	case len(f.priorities) > 0 && f.noPriority:
+		query = query.Where("(priority IN ? OR priority IS NULL)", f.priorities)
+	case len(f.priorities) > 0:
+		query = query.Where("priority IN ?", f.priorities)
+	case f.noPriority:
+		query = query.Where("priority IS NULL")
+	}
+
+	switch f.status {
+	case "open":
+		query = query.Where("completed = ?", false)
+	case "completed":
+		query = query.Where("completed = ?", true)
+	}
+
+	if f.overdue != nil {
+		condition := overdueCondition
+		if !*f.overdue {
+			condition = "NOT (" + overdueCondition + ")"
+		}
+		query = query.Where(condition, now, startOfDay(now, loc))
+	}
+	if f.hasDue != nil {
+		if *f.hasDue {
+			query = query.Where("due_at IS NOT NULL")
+		} else {
+			query = query.Where("due_at IS NULL")
+		}
+	}
+	if f.recurring != nil {
+		if *f.recurring {
+			query = query.Where("recurrence <> ''")
+		} else {
+			query = query.Where("recurrence = '' OR recurrence IS NULL")
+		}
+	}
+
+	switch {
+	case f.inbox:
+		query = query.Where("project_id IS NULL")
+	case f.projectID != nil:
+		query = query.Where("project_id = ?", *f.projectID)
+	case !f.includeArchived:
+		query = query.Where("project_id IS NULL OR project_id NOT IN (?)",
+			db.Model(&Project{}).Select("id").Where("user_id = ? AND archived = ?", userId, true))
+	}
+
+	if f.rootOnly {
+		query = query.Where("parent_id IS NULL")
+	} else if f.parentID != nil {
+		query = query.Where("parent_id = ?", *f.parentID)
+	}
+
+	if len(f.tags) > 0 {
+		query = query.Where("id IN (?)", taggedTaskIDs(userId, f.tags, f.matchAllTags))
+	}
+
+	query = applyTimeRange(query, "due_at", f.due)
+	query = applyTimeRange(query, "created_date", f.created)
+	query = applyTimeRange(query, "lastupdated", f.updated)
+	query = applyTimeRange(query, "completed_at", f.completed)
+	return query
+}
+
+const maxTaskPageSize = 100
+
+// taskCursor — непрозрачная позиция keyset-пагинации, которую клиент получает
+// как nextCursor: ключи сортировки последней задачи и сама сортировка.
+type taskCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+func sortSignature(orders []taskOrder) string {
+	keys := make([]string, len(orders))
+	for i, order := range orders {
+		keys[i] = order.field
+		if order.desc {
+			keys[i] = "-" + order.field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func encodeTaskCursor(task *Task, orders []taskOrder) string {
+	cursor := taskCursor{Sort: sortSignature(orders)}
+	for _, order := range orders {
+		cursor.Values = append(cursor.Values, taskSortFields[order.field].value(task))
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTaskCursor(value string, orders []taskOrder) ([]interface{}, error) {
+	invalid := &queryError{message: "Неверный курсор"}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor taskCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || len(cursor.Values) != len(orders) {
+		return nil, invalid
+	}
+	if cursor.Sort != sortSignature(orders) {
+		return nil, &queryError{message: "Курсор получен для другой сортировки", allowed: []string{cursor.Sort}}
+	}
+
+	values := make([]interface{}, len(orders))
+	for i, order := range orders {
+		raw := cursor.Values[i]
+		if field := taskSortFields[order.field]; field.numeric {
+			if raw == nil {
+				continue
+			}
+			number, ok := raw.(float64)
+			if !ok {
+				return nil, invalid
+			}
+			values[i] = int(number)
+			continue
+		}
+		switch sample := taskSortFields[order.field].value(&Task{}); sample.(type) {
+		case bool:
+			b, ok := raw.(bool)
+			if !ok {
+				return nil, invalid
+			}
+			values[i] = b
+		case string:
+			str, ok := raw.(string)
+			if !ok {
+				return nil, invalid
+			}
+			values[i] = str
+		default:
+			// время: nil для пустых значений nullable-полей
+			if raw == nil {
+				if !taskSortFields[order.field].nullable {
+					return nil, invalid
+				}
+				continue
+			}
+			str, ok := raw.(string)
+			if !ok {
+				return nil, invalid
+			}
+			t, err := time.Parse(time.RFC3339Nano, str)
+			if err != nil {
+				return nil, invalid
+			}
+			values[i] = t
+		}
+	}
+	return values, nil
+}
+
+// afterCursor оставляет в запросе только строки строго после позиции курсора.
+// Для ключей k1..kn строится (k1 > v1) OR (k1 = v1 AND k2 > v2) OR …, где
+// ключ, допускающий NULL, раскрывается в "col IS NULL" и затем саму колонку,
+// как в порядке NULLS LAST из orderTasks.
+func afterCursor(query *gorm.DB, orders []taskOrder, values []interface{}) *gorm.DB {
+	type key struct {
+		greater   string
+		greaterAt []interface{}
+		equal     string
+		equalAt   []interface{}
+	}
+	var keys []key
+	for i, order := range orders {
+		field := taskSortFields[order.field]
+		op := " > ?"
+		if order.desc {
+			op = " < ?"
+		}
+		if !field.nullable {
+			keys = append(keys, key{field.column + op, []interface{}{values[i]}, field.column + " = ?", []interface{}{values[i]}})
+			continue
+		}
+		if values[i] == nil {
+			// Среди пустых значений порядок определяют следующие ключи
+			keys = append(keys, key{equal: field.column + " IS NULL"})
+			continue
+		}
+		keys = append(keys,
+			key{greater: field.column + " IS NULL", equal: field.column + " IS NOT NULL"},
+			key{field.column + op, []interface{}{values[i]}, field.column + " = ?", []interface{}{values[i]}})
+	}
+
+	var terms []string
+	var args []interface{}
+	for i, k := range keys {
+		if k.greater == "" {
+			continue
+		}
+		var parts []string
+		for _, prev := range keys[:i] {
+			parts = append(parts, prev.equal)
+			args = append(args, prev.equalAt...)
+		}
+		parts = append(parts, k.greater)
+		args = append(args, k.greaterAt...)
+		terms = append(terms, "("+strings.Join(parts, " AND ")+")")
+	}
+	if len(terms) == 0 {
+		return query.Where("1 = 0")
+	}
+	return query.Where("("+strings.Join(terms, " OR ")+")", args...)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
@@ -19,15 +20,15 @@ import (
 	"net/smtp"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
 var (
-	limiter        = rate.NewLimiter(300, 1) // Rate limit of 1 request
-	db             *gorm.DB
-	log            *logrus.Logger
-	jwtSecret      = []byte(os.Getenv("JWT_SECRET"))
-	tokenExpiresIn = time.Hour * 24
+	limiter   = rate.NewLimiter(300, 1) // Rate limit of 1 request
+	db        *gorm.DB
+	log       *logrus.Logger
+	jwtSecret = []byte(os.Getenv("JWT_SECRET"))
 )
 
 const (
@@ -35,13 +36,30 @@ const (
 )
 
 type Task struct {
-	ID          uuid.UUID `gorm:"primaryKey"`
-	Name        string    `json:"name"`
-	Details     string    `json:"details"`
-	CreatedDate time.Time `json:"createdDate"`
-	HaveStar    bool      `json:"star" gorm:"default:false"`
-	LastUpdated time.Time `json:"lastUpdated" gorm:"column:lastupdated"`
-	UserId      uint      `json:"userId"`
+	ID               uuid.UUID      `gorm:"primaryKey"`
+	Name             string         `json:"name"`
+	Details          string         `json:"details"`
+	CreatedDate      time.Time      `json:"createdDate"`
+	HaveStar         bool           `json:"star" gorm:"default:false"`
+	Priority         *int           `json:"priority"`
+	LastUpdated      time.Time      `json:"lastUpdated" gorm:"column:lastupdated"`
+	UserId           uint           `json:"userId"`
+	ProjectID        *uuid.UUID     `json:"projectId"`
+	ParentID         *uuid.UUID     `json:"parentId"`
+	DueAt            *time.Time     `json:"dueAt"`
+	DueHasTime       bool           `json:"dueHasTime" gorm:"default:false"`
+	Overdue          bool           `json:"overdue" gorm:"-"`
+	Completed        bool           `json:"completed" gorm:"default:false"`
+	CompletedAt      *time.Time     `json:"completedAt"`
+	Recurrence       string         `json:"recurrence"`
+	NextOccurrenceID *uuid.UUID     `json:"nextOccurrenceId"`
+	Tags             []Tag          `json:"tags" gorm:"many2many:task_tags;"`
+	Progress         *TaskProgress  `json:"progress,omitempty" gorm:"-"`
+	DeletedAt        gorm.DeletedAt `json:"deletedAt" gorm:"index"`
+	// Version растёт при каждом изменении и служит ETag задачи
+	Version int `json:"version" gorm:"not null;default:1"`
+	// Position — позиция в списке для ручной сортировки, см. position.go
+	Position string `json:"position" gorm:"type:text COLLATE ucs_basic;not null;default:'';index"`
 }
 
 type User struct {
@@ -52,6 +70,11 @@ type User struct {
 	IsActivated    bool   `json:"isActivated"`
 	ActivationLink string `json:"activationLink"`
 	ROLE           string `json:"-"`
+	TimeZone       string `json:"timeZone"`
+	// TOTPSecret задаётся при настройке 2FA; вход требует код, только когда TOTPEnabled
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"totpEnabled" gorm:"not null;default:false"`
+	TOTPLastStep int64  `json:"-" gorm:"not null;default:0"`
 }
 
 type Claims struct {
@@ -60,23 +83,153 @@ type Claims struct {
 	Email       string `json:"email"`
 	UserId      uint   `json:"userId"`
 	ROLE        string `json:"role"`
+	SessionID   string `json:"sid"`
 	jwt.StandardClaims
 }
 
+// RegisterRequest — поля, которые клиент задаёт при регистрации; остальное
+// (активация, роль, 2FA) сервер выставляет сам
+type RegisterRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	TimeZone string `json:"timeZone"`
+}
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 }
 
+// TaskPage — ответ GetTasks. Page и TotalPages заполняются только при постраничной выдаче по номеру страницы.
+type TaskPage struct {
+	Items      []Task `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"pageSize"`
+	TotalPages int    `json:"totalPages,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn — срок жизни access-токена в секундах
+	ExpiresIn int `json:"expiresIn"`
 }
 
+// ToggleHaveStar переключает звезду. Звезда задаёт приоритет starPriority,
+// если приоритета ещё нет, и снимает его, если он совпадает со звёздным.
 func (t *Task) ToggleHaveStar() {
 	t.HaveStar = !t.HaveStar
+	switch {
+	case t.HaveStar && t.Priority == nil:
+		priority := starPriority
+		t.Priority = &priority
+	case !t.HaveStar && t.Priority != nil && *t.Priority == starPriority:
+		t.Priority = nil
+	}
 	t.LastUpdated = time.Now()
 }
 
+func (t *Task) Complete() {
+	if t.Completed {
+		return
+	}
+	now := time.Now()
+	t.Completed = true
+	t.CompletedAt = &now
+	t.LastUpdated = now
+}
+
+func (t *Task) Reopen() {
+	if !t.Completed {
+		return
+	}
+	t.Completed = false
+	t.CompletedAt = nil
+	t.LastUpdated = time.Now()
+}
+
+// syncCompletion согласует CompletedAt с Completed, если тот был задан напрямую, например через UpdateTask
+func (t *Task) syncCompletion() {
+	if t.Completed && t.CompletedAt == nil {
+		now := time.Now()
+		t.CompletedAt = &now
+	}
+	if !t.Completed {
+		t.CompletedAt = nil
+	}
+}
+
+// normalizeDue приводит срок к UTC; срок без времени хранится как начало дня в часовом поясе пользователя
+func (t *Task) normalizeDue(loc *time.Location) {
+	if t.DueAt == nil {
+		t.DueHasTime = false
+		return
+	}
+	due := t.DueAt.In(loc)
+	if !t.DueHasTime {
+		due = time.Date(due.Year(), due.Month(), due.Day(), 0, 0, 0, 0, loc)
+	}
+	due = due.UTC()
+	t.DueAt = &due
+}
+
+// Deadline возвращает момент, после которого задача просрочена. Срок без времени
+// действует до конца дня в часовом поясе пользователя.
+func (t *Task) Deadline(loc *time.Location) time.Time {
+	if t.DueHasTime {
+		return *t.DueAt
+	}
+	due := t.DueAt.In(loc)
+	return time.Date(due.Year(), due.Month(), due.Day()+1, 0, 0, 0, 0, loc)
+}
+
+// IsOverdue совпадает с overdueCondition: выполненная задача не бывает просроченной
+func (t *Task) IsOverdue(now time.Time, loc *time.Location) bool {
+	if t.DueAt == nil || t.Completed {
+		return false
+	}
+	return now.After(t.Deadline(loc))
+}
+
+func userLocation(userId uint) *time.Location {
+	var user User
+	if err := db.Select("time_zone").First(&user, userId).Error; err != nil || user.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(user.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// parseTimeParam принимает время в RFC 3339 или дату (2006-01-02) — её начало
+// в часовом поясе пользователя
+func parseTimeParam(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// pageLink строит элемент заголовка Link (RFC 8288): текущий запрос с заменённым
+// параметром param
+func pageLink(c *gin.Context, param, value, rel string) string {
+	link := *c.Request.URL
+	query := link.Query()
+	query.Set(param, value)
+	link.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=%q", link.RequestURI(), rel)
+}
+
 func checkLimiter(c *gin.Context) {
 	if !limiter.Allow() {
 		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
@@ -84,6 +237,36 @@ func checkLimiter(c *gin.Context) {
 	}
 }
 
+// schemaModels — таблицы, которые создаёт AutoMigrate помимо задач
+var schemaModels = []interface{}{
+	&User{}, &Session{}, &PasswordReset{}, &RecoveryCode{}, &TwoFactorChallenge{}, &ApiToken{},
+	&OIDCState{}, &UserIdentity{}, &Project{}, &Tag{}, &Reminder{}, &Notification{}, &SavedView{}, &TaskRevision{},
+}
+
+// migrateSchema приводит схему базы к моделям. Колонка priority появилась позже
+// остальных: при её создании отмеченные звездой задачи получают приоритет.
+func migrateSchema() error {
+	hadPriority := db.Migrator().HasColumn(&Task{}, "priority")
+	if err := db.AutoMigrate(&Task{}); err != nil {
+		return err
+	}
+	if !hadPriority {
+		migrated, err := migrateStarPriority(db)
+		if err != nil {
+			return fmt.Errorf("migrate starred tasks to priorities: %w", err)
+		}
+		log.WithFields(logrus.Fields{
+			"action":   "migrateStarPriority",
+			"priority": starPriority,
+			"tasks":    migrated,
+		}).Info("Starred tasks migrated to priorities")
+	}
+	if err := db.AutoMigrate(schemaModels...); err != nil {
+		return err
+	}
+	return setupTaskSearch()
+}
+
 func main() {
 	log = logrus.New()
 	var err error
@@ -112,39 +295,134 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	db.AutoMigrate(&Task{})
-	db.AutoMigrate(&User{})
+	if starPriority, err = loadStarPriority(); err != nil {
+		log.Fatal(err)
+	}
+	if oidcClient, err = loadOIDCProvider(); err != nil {
+		log.Fatal(err)
+	}
+	if err := migrateSchema(); err != nil {
+		log.Fatal("Failed to migrate the database:", err)
+	}
 
 	if err := CreateAdminUser(); err != nil {
 		log.Fatal("Failed to create admin user:", err)
 	}
 
+	NewReminderScheduler(realClock{}, defaultNotifiers()).Start(context.Background())
+
+	retention, err := trashRetention()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if retention > 0 {
+		NewTrashPurger(realClock{}, retention).Start(context.Background())
+	}
+	NewRankRebalancer().Start(context.Background())
+
+	r := newRouter()
+
+	// Start server
+	log.Println("Сервер запущен на порту :8000")
+	log.Fatal(http.ListenAndServe(":8000", r))
+}
+
+// newRouter регистрирует все маршруты API
+func newRouter() *gin.Engine {
 	r := gin.Default()
 
 	// CORS middleware
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{os.Getenv("CLIENT_URL")}
-	config.AllowMethods = []string{"GET", "PATCH", "POST", "PUT", "DELETE", "OPTIONS"}                                                   // Разрешить все методы
-	config.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", "Access-Control-Allow-Headers", "Accept, Accept-Language"} // Разрешить определенные заголовки
+	config.AllowMethods = []string{"GET", "PATCH", "POST", "PUT", "DELETE", "OPTIONS"}                                                               // Разрешить все методы
+	config.AllowHeaders = []string{"Origin", "Authorization", "Content-Type", "Access-Control-Allow-Headers", "Accept, Accept-Language", "If-Match"} // Разрешить определенные заголовки
+	config.ExposeHeaders = []string{"X-Total-Count", "Link", "ETag"}
 	r.Use(cors.New(config))
 
 	// Public routes
 	r.POST("/register", Register)
 	r.POST("/login", Login)
+	r.POST("/login/2fa", LoginTwoFactor)
+	r.POST("/refresh", Refresh)
+	r.POST("/logout", AuthMiddleware(), Logout)
+	r.POST("/logout-all", AuthMiddleware(), LogoutAll)
+	r.POST("/password/forgot", ForgotPassword)
+	r.POST("/password/reset", ResetPassword)
+	r.GET("/auth/oidc", GetOIDCConfig)
+	r.GET("/auth/oidc/login", OIDCLogin)
+	r.GET("/auth/oidc/callback", OIDCCallback)
 	r.GET("/activate/:activationLink", Activate)
-	r.GET("/resend-activation-link", ResendActivationLink)
+	r.GET("/resend-activation-link", AuthMiddleware(), ResendActivationLink)
 	// Auth middleware
 	auth := r.Group("/api")
 	auth.Use(AuthMiddleware())
 	{
 
 		auth.GET("/user-info", UserInfo)
+		auth.PUT("/user/timezone", UpdateTimeZone)
+		auth.PUT("/user/password", ChangePassword)
+		auth.POST("/user/2fa/setup", SetupTwoFactor)
+		auth.POST("/user/2fa/enable", EnableTwoFactor)
+		auth.POST("/user/2fa/disable", DisableTwoFactor)
+		auth.POST("/user/2fa/recovery-codes", RegenerateRecoveryCodes)
+		auth.GET("/user/sessions", GetSessions)
+		auth.DELETE("/user/sessions/:id", RevokeSession)
+		auth.GET("/tokens", GetApiTokens)
+		auth.POST("/tokens", CreateApiToken)
+		auth.DELETE("/tokens/:id", DeleteApiToken)
 		auth.GET("/tasks", GetTasks)
+		auth.GET("/tasks/search", SearchTasks)
 		auth.GET("/tasks/:id", GetTask)
 		auth.POST("/tasks", CreateTask)
+		auth.POST("/tasks/bulk", BulkTasks)
 		auth.PUT("/tasks/:id", UpdateTask)
+		auth.PATCH("/tasks/:id", PatchTask)
 		auth.DELETE("/tasks/:id", DeleteTask)
+		auth.POST("/tasks/:id/position", RepositionTask)
 		auth.PUT("/tasks/:id/toggle-star", ToggleStarTask)
+		auth.PUT("/tasks/:id/complete", CompleteTask)
+		auth.PUT("/tasks/:id/reopen", ReopenTask)
+
+		auth.GET("/tasks/:id/children", GetTaskChildren)
+		auth.GET("/tasks/:id/history", GetTaskHistory)
+		auth.POST("/tasks/:id/history/:rev/restore", RestoreTaskRevision)
+		auth.PUT("/tasks/:id/move", MoveTask)
+		auth.PUT("/tasks/:id/tags/:tagId", AttachTag)
+		auth.DELETE("/tasks/:id/tags/:tagId", DetachTag)
+
+		auth.GET("/tasks/:id/reminders", GetTaskReminders)
+		auth.POST("/tasks/:id/reminders", CreateReminder)
+		auth.DELETE("/reminders/:id", DeleteReminder)
+		auth.GET("/inbox", GetInbox)
+		auth.PUT("/inbox/:id/read", MarkNotificationRead)
+
+		auth.GET("/tags", GetTags)
+		auth.POST("/tags", CreateTag)
+		auth.PUT("/tags/:id", UpdateTag)
+		auth.POST("/tags/:id/merge", MergeTag)
+		auth.DELETE("/tags/:id", DeleteTag)
+
+		auth.GET("/projects", GetProjects)
+		auth.GET("/projects/:id", GetProject)
+		auth.POST("/projects", CreateProject)
+		auth.PUT("/projects/:id", UpdateProject)
+		auth.DELETE("/projects/:id", DeleteProject)
+		auth.PUT("/projects/:id/archive", ArchiveProject)
+		auth.PUT("/projects/:id/unarchive", UnarchiveProject)
+
+		auth.GET("/lists/:list", GetSmartList)
+
+		auth.GET("/trash", GetTrash)
+		auth.DELETE("/trash", EmptyTrash)
+		auth.POST("/trash/:id/restore", RestoreTask)
+		auth.DELETE("/trash/:id", PurgeTask)
+
+		auth.GET("/views", GetViews)
+		auth.GET("/views/:id", GetView)
+		auth.POST("/views", CreateView)
+		auth.PUT("/views/:id", UpdateView)
+		auth.DELETE("/views/:id", DeleteView)
+		auth.GET("/views/:id/tasks", GetViewTasks)
 
 	}
 
@@ -152,11 +430,9 @@ func main() {
 	{
 		auth.GET("/admin/users", GetAllUsers)
 		auth.POST("/admin/mailing", SendEmailToAllUsers)
+		auth.DELETE("/admin/users/:id/2fa", ResetUserTwoFactor)
 	}
-
-	// Start server
-	log.Println("Сервер запущен на порту :8000")
-	log.Fatal(http.ListenAndServe(":8000", r))
+	return r
 }
 
 func GetAllUsers(c *gin.Context) {
@@ -174,6 +450,7 @@ func GetAllUsers(c *gin.Context) {
 			"Email":       user.Email,
 			"IsActivated": user.IsActivated,
 			"ROLE":        user.ROLE,
+			"TOTPEnabled": user.TOTPEnabled,
 		}
 		usersResponse = append(usersResponse, userResponse)
 	}
@@ -182,17 +459,28 @@ func GetAllUsers(c *gin.Context) {
 }
 
 func Register(c *gin.Context) {
-	var user User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var request RegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	user := User{
+		Username: request.Username,
+		Email:    request.Email,
+		Password: request.Password,
+		TimeZone: request.TimeZone,
+	}
 
 	if user.Username == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
 		return
 	}
 
+	if _, err := time.LoadLocation(user.TimeZone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+		return
+	}
+
 	var existingEmailUser User
 	if err := db.Where("email = ?", user.Email).First(&existingEmailUser).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
@@ -212,7 +500,6 @@ func Register(c *gin.Context) {
 		return
 	}
 	user.ActivationLink = uuid.New().String()
-	user.IsActivated = false
 	user.ROLE = "USER"
 	user.Password = string(hashedPassword)
 	if err := db.Create(&user).Error; err != nil {
@@ -242,23 +529,12 @@ func SendActivationEmail(to, activationLink string) error {
 }
 
 func ResendActivationLink(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
-		return
-	}
-	tokenString := authHeader[len("Bearer "):]
-
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	principal, ok := currentPrincipal(c)
+	if !ok {
 		return
 	}
 
-	userId := claims.UserId
+	userId := principal.UserId
 	if userId == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "UserId is required"})
 		return
@@ -304,13 +580,24 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token, err := GenerateToken(user.ID, user.Username, user.Email, user.IsActivated, user.ROLE)
+	if user.TOTPEnabled {
+		// Второй шаг: POST /login/2fa с кодом из приложения или кодом восстановления
+		challengeToken, err := startTwoFactorChallenge(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start two-factor login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"twoFactorRequired": true, "challengeToken": challengeToken})
+		return
+	}
+
+	tokens, err := issueTokens(c, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, TokenResponse{Token: token})
+	c.JSON(http.StatusOK, tokens)
 }
 
 func CreateAdminUser() error {
@@ -364,14 +651,16 @@ func Activate(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "User activated successfully"})
 }
 
-func GenerateToken(userId uint, username, email string, isActivated bool, role string) (string, error) {
-	expirationTime := time.Now().Add(tokenExpiresIn)
+// GenerateToken выдаёт короткоживущий access-токен сессии sessionID
+func GenerateToken(user *User, sessionID uuid.UUID) (string, error) {
+	expirationTime := time.Now().Add(accessTokenExpiresIn)
 	claims := &Claims{
-		UserId:      userId,
-		Username:    username,
-		IsActivated: isActivated,
-		Email:       email,
-		ROLE:        role,
+		UserId:      user.ID,
+		Username:    user.Username,
+		IsActivated: user.IsActivated,
+		Email:       user.Email,
+		ROLE:        user.ROLE,
+		SessionID:   sessionID.String(),
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 		},
@@ -380,126 +669,143 @@ func GenerateToken(userId uint, username, email string, isActivated bool, role s
 	return token.SignedString(jwtSecret)
 }
 
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
-			return
-		}
-
-		tokenString := authHeader[len("Bearer "):]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
-		}
-
-		c.Next()
-	}
-}
-
-func AdminAuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
-			return
-		}
-
-		tokenString := authHeader[len("Bearer "):]
-		claims := &Claims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
-		}
-
-		// Проверка роли пользователя
-		if claims.ROLE != "ADMIN" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Insufficient permissions"})
-			return
-		}
-
-		c.Next()
-	}
-}
-
 func GetTasks(c *gin.Context) {
 	checkLimiter(c)
 	if c.IsAborted() {
 		return
 	}
-	var tasks []Task
+	listTasks(c, "getTasks", c.Query("q"), c.Query("sort"))
+}
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
-		return
-	}
-	tokenString := authHeader[len("Bearer "):]
+// listTasks отдаёт страницу задач для GetTasks и сохранённых представлений:
+// q — выражение языка запросов, sort — список полей сортировки.
+func listTasks(c *gin.Context, action, q, sort string) {
+	var tasks []Task
 
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	principal, ok := currentPrincipal(c)
+	if !ok {
 		return
 	}
 
-	userId := claims.UserId
+	userId := principal.UserId
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-	nameFilter := c.Query("name")
-	detailsFilter := c.Query("details")
-	starFilter, _ := strconv.ParseBool(c.Query("star"))
-	sortField := c.Query("sortField")
-	sortOrder := c.DefaultQuery("sortOrder", "asc")
-
-	if sortField == "" {
-		sortField = "ID"
+	if page < 1 {
+		page = 1
 	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	if pageSize > maxTaskPageSize {
+		pageSize = maxTaskPageSize
+	}
+	cursor, cursorMode := c.GetQuery("cursor")
 
-	offset := (page - 1) * pageSize
-
-	query := db.Offset(offset).Limit(pageSize).Where("user_id = ?", userId)
+	loc := userLocation(userId)
+	now := time.Now()
 
-	if nameFilter != "" {
-		query = query.Where("name LIKE ?", "%"+nameFilter+"%")
+	filter, err := parseTaskFilter(c, loc)
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	orders, err := parseTaskSort(sort, c.Query("sortField"), c.Query("sortOrder"))
+	if err != nil {
+		respondQueryError(c, err)
+		return
+	}
+	query, err := parseTaskQuery(q, userId, now, loc)
+	if err != nil {
+		respondQueryError(c, err)
+		return
 	}
 
-	if detailsFilter != "" {
-		query = query.Where("details LIKE ?", "%"+detailsFilter+"%")
+	base := db.Model(&Task{}).Scopes(taskScope(userId))
+	if query != nil {
+		// Условие на статус в q важнее значения status=open по умолчанию
+		if query.completion && c.Query("status") == "" {
+			filter.status = "all"
+		}
+		base = base.Where(query.condition, query.args...)
 	}
+	base = filter.apply(base, userId, now, loc).Session(&gorm.Session{})
 
-	if starFilter {
-		query = query.Where("have_star = ?", true)
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения задач"})
+		return
 	}
 
-	orderClause := sortField + " " + sortOrder
-	query = query.Order(orderClause)
+	// Запрашиваем на одну задачу больше, чтобы узнать, есть ли следующая страница
+	pageQuery := orderTasks(base.Preload("Tags"), orders).Limit(pageSize + 1)
+	if cursorMode {
+		if cursor != "" {
+			values, err := decodeTaskCursor(cursor, orders)
+			if err != nil {
+				respondQueryError(c, err)
+				return
+			}
+			pageQuery = afterCursor(pageQuery, orders, values)
+		}
+	} else {
+		pageQuery = pageQuery.Offset((page - 1) * pageSize)
+	}
 
-	if err := query.Find(&tasks).Error; err != nil {
+	if err := pageQuery.Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения задач"})
 		return
 	}
+	hasMore := len(tasks) > pageSize
+	if hasMore {
+		tasks = tasks[:pageSize]
+	}
+	for i := range tasks {
+		tasks[i].Overdue = tasks[i].IsOverdue(now, loc)
+	}
+
+	response := TaskPage{Items: tasks, Total: total, PageSize: pageSize}
+	if response.Items == nil {
+		response.Items = []Task{}
+	}
+	if hasMore {
+		response.NextCursor = encodeTaskCursor(&tasks[len(tasks)-1], orders)
+	}
+
+	var links []string
+	if cursorMode {
+		if hasMore {
+			links = append(links, pageLink(c, "cursor", response.NextCursor, "next"))
+		}
+	} else {
+		response.Page = page
+		response.TotalPages = int((total + int64(pageSize) - 1) / int64(pageSize))
+		links = append(links, pageLink(c, "page", "1", "first"))
+		if page > 1 {
+			links = append(links, pageLink(c, "page", strconv.Itoa(page-1), "prev"))
+		}
+		if hasMore {
+			links = append(links, pageLink(c, "page", strconv.Itoa(page+1), "next"))
+		}
+		if response.TotalPages > 0 {
+			links = append(links, pageLink(c, "page", strconv.Itoa(response.TotalPages), "last"))
+		}
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+
 	log.WithFields(logrus.Fields{
-		"action":     "getTasks",
+		"action":     action,
 		"page":       page,
 		"pageSize":   pageSize,
-		"nameFilter": nameFilter,
-	}).Info("GetTasks executed successfully")
+		"cursor":     cursorMode,
+		"nameFilter": filter.name,
+		"query":      q,
+	}).Info("Tasks listed successfully")
 
-	c.JSON(http.StatusOK, tasks)
+	c.JSON(http.StatusOK, response)
 }
 
 func GetTask(c *gin.Context) {
@@ -507,17 +813,24 @@ func GetTask(c *gin.Context) {
 	if c.IsAborted() {
 		return
 	}
-	var task Task
-	id := c.Param("id")
-	if err := db.First(&task, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+	task, _, ok := findUserTask(c, "getTask", db.Preload("Tags"))
+	if !ok {
+		return
+	}
+
+	task.Overdue = task.IsOverdue(time.Now(), userLocation(task.UserId))
+	progress, err := taskProgress(task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения задачи"})
 		return
 	}
+	task.Progress = progress
 
 	log.WithFields(logrus.Fields{
 		"action": "getTasks",
 	}).Info("GetTask executed successfully")
 
+	c.Header("ETag", taskETag(&task))
 	c.JSON(http.StatusOK, task)
 }
 
@@ -561,31 +874,91 @@ func SendEmail(to, subject, body string) error {
 }
 
 func UserInfo(c *gin.Context) {
-	// Получаем токен из заголовка Authorization
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
+	principal, ok := currentPrincipal(c)
+	if !ok {
 		return
 	}
-	tokenString := authHeader[len("Bearer "):]
 
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	userInfo := gin.H{
+		"userId":      principal.UserId,
+		"username":    principal.Username,
+		"email":       principal.Email,
+		"isActivated": principal.IsActivated,
+		"ROLE":        principal.Role,
+	}
+	c.JSON(http.StatusOK, userInfo)
+}
+
+func UpdateTimeZone(c *gin.Context) {
+	var request struct {
+		TimeZone string `json:"timeZone"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if _, err := time.LoadLocation(request.TimeZone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
 		return
 	}
 
-	userInfo := gin.H{
-		"userId":      claims.UserId,
-		"username":    claims.Username,
-		"email":       claims.Email,
-		"isActivated": claims.IsActivated,
-		"ROLE":        claims.ROLE,
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
 	}
-	c.JSON(http.StatusOK, userInfo)
+
+	if err := db.Model(&User{}).Where("id = ?", principal.UserId).Update("time_zone", request.TimeZone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update time zone"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"timeZone": request.TimeZone})
+}
+
+// prepareNewTask заполняет служебные поля новой задачи и проверяет родителя и проект
+func prepareNewTask(tx *gorm.DB, task *Task, userId uint) error {
+	task.ID = uuid.New()
+	task.CreatedDate = time.Now()
+	task.LastUpdated = task.CreatedDate
+	task.HaveStar = false
+	task.Tags = nil // теги назначаются через /tasks/:id/tags
+	task.NextOccurrenceID = nil
+	task.DeletedAt = gorm.DeletedAt{}
+	task.Version = 1
+	if err := task.normalizeRecurrence(); err != nil {
+		return &requestError{status: http.StatusBadRequest, message: "Неверное правило повторения: " + err.Error()}
+	}
+	task.syncCompletion()
+	if err := task.validatePriority(); err != nil {
+		return err
+	}
+	task.UserId = userId
+	task.normalizeDue(userLocation(task.UserId))
+
+	if task.ParentID != nil {
+		var parent Task
+		if err := tx.Scopes(taskScope(task.UserId)).First(&parent, "id = ?", *task.ParentID).Error; err != nil {
+			return &requestError{status: http.StatusBadRequest, message: "Родительская задача не найдена"}
+		}
+		// Подзадача всегда находится в проекте родителя
+		task.ProjectID = parent.ProjectID
+	}
+
+	if task.ProjectID != nil && !projectBelongsTo(*task.ProjectID, task.UserId) {
+		return &requestError{status: http.StatusBadRequest, message: "Проект не найден"}
+	}
+
+	// Новая задача добавляется в конец списка
+	position, err := appendPosition(tx, taskListOf(task))
+	task.Position = position
+	return err
+}
+
+func createTask(tx *gorm.DB, task *Task, userId uint) error {
+	if err := tx.Create(task).Error; err != nil {
+		return err
+	}
+	return recordRevision(tx, task, nil, userId, "create", nil)
 }
 
 func CreateTask(c *gin.Context) {
@@ -603,28 +976,17 @@ func CreateTask(c *gin.Context) {
 		return
 	}
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing Authorization header"})
+	principal, ok := currentPrincipal(c)
+	if !ok {
 		return
 	}
-	tokenString := authHeader[len("Bearer "):]
-
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	if err := prepareNewTask(db, &newTask, principal.UserId); err != nil {
+		respondRequestError(c, err)
 		return
 	}
-	newTask.ID = uuid.New()
-	newTask.CreatedDate = time.Now()
-	newTask.LastUpdated = newTask.CreatedDate
-	newTask.HaveStar = false
-	newTask.UserId = claims.UserId // Назначить userId в поле newTask.UserId
 
-	if err := db.Create(&newTask).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error { return createTask(tx, &newTask, principal.UserId) })
+	if err != nil {
 		log.WithFields(logrus.Fields{
 			"action": "createTask",
 			"error":  err.Error(),
@@ -638,6 +1000,7 @@ func CreateTask(c *gin.Context) {
 		"taskID": newTask.ID,
 	}).Info("Task created successfully")
 
+	c.Header("ETag", taskETag(&newTask))
 	c.JSON(http.StatusCreated, newTask)
 }
 
@@ -646,28 +1009,17 @@ func UpdateTask(c *gin.Context) {
 	if c.IsAborted() {
 		return
 	}
-	var updatedTask Task
-	id := c.Param("id")
-
-	taskID, err := uuid.Parse(id)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "updateTask",
-			"error":  err.Error(),
-		}).Error("Error parsing task ID")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор задачи"})
-		return
-	}
-
-	if err := db.First(&updatedTask, taskID).Error; err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "updateTask",
-			"error":  err.Error(),
-		}).Error("Error retrieving task for update")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+	updatedTask, principal, ok := findUserTask(c, "updateTask", db)
+	if !ok || !checkIfMatch(c, &updatedTask) {
 		return
 	}
 
+	before := snapshotOf(&updatedTask)
+	taskID, userId, createdDate := updatedTask.ID, updatedTask.UserId, updatedTask.CreatedDate
+	parentID := updatedTask.ParentID
+	nextOccurrenceID := updatedTask.NextOccurrenceID
+	version, position := updatedTask.Version, updatedTask.Position
+	wasCompleted := updatedTask.Completed
 	if err := c.BindJSON(&updatedTask); err != nil {
 		log.WithFields(logrus.Fields{
 			"action": "updateTask",
@@ -676,24 +1028,15 @@ func UpdateTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
 		return
 	}
+	// Служебные поля из тела запроса игнорируются; частичное обновление — PATCH /tasks/:id
+	updatedTask.ID, updatedTask.UserId, updatedTask.CreatedDate = taskID, userId, createdDate
+	updatedTask.ParentID = parentID // родитель меняется только через /tasks/:id/move
+	updatedTask.NextOccurrenceID = nextOccurrenceID
+	updatedTask.Version = version
+	updatedTask.Position = position          // порядок меняется через /tasks/:id/position
+	updatedTask.DeletedAt = gorm.DeletedAt{} // удаление — только через DELETE /tasks/:id
 
-	updatedTask.LastUpdated = time.Now()
-
-	if err := db.Save(&updatedTask).Error; err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "updateTask",
-			"error":  err.Error(),
-		}).Error("Error updating task in the database")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
-		return
-	}
-
-	log.WithFields(logrus.Fields{
-		"action": "updateTask",
-		"taskID": updatedTask.ID,
-	}).Info("Task updated successfully")
-
-	c.JSON(http.StatusOK, updatedTask)
+	saveTaskUpdate(c, "updateTask", "update", &updatedTask, before, wasCompleted, principal.UserId)
 }
 
 func DeleteTask(c *gin.Context) {
@@ -701,30 +1044,18 @@ func DeleteTask(c *gin.Context) {
 	if c.IsAborted() {
 		return
 	}
-	var task Task
-	id := c.Param("id")
-
-	// Преобразовать id в uuid.UUID
-	taskID, err := uuid.Parse(id)
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "deleteTask",
-			"error":  err.Error(),
-		}).Error("Error parsing task ID")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор задачи"})
+	task, _, ok := findUserTask(c, "deleteTask", db)
+	if !ok {
 		return
 	}
 
-	if err := db.First(&task, taskID).Error; err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "deleteTask",
-			"error":  err.Error(),
-		}).Error("Error retrieving task for delete")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+	children := c.DefaultQuery("children", "cascade")
+	if children != "cascade" && children != "promote" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверное значение children: допустимы cascade, promote"})
 		return
 	}
 
-	if err := db.Delete(&task).Error; err != nil {
+	if err := db.Transaction(func(tx *gorm.DB) error { return deleteTaskTree(tx, &task, children) }); err != nil {
 		log.WithFields(logrus.Fields{
 			"action": "deleteTask",
 			"error":  err.Error(),
@@ -738,7 +1069,7 @@ func DeleteTask(c *gin.Context) {
 		"taskID": task.ID,
 	}).Info("Task deleted successfully")
 
-	c.JSON(http.StatusOK, gin.H{"message": "Задача успешно удалена"})
+	c.JSON(http.StatusOK, gin.H{"message": "Задача перемещена в корзину"})
 }
 
 func ToggleStarTask(c *gin.Context) {
@@ -746,32 +1077,25 @@ func ToggleStarTask(c *gin.Context) {
 	if c.IsAborted() {
 		return
 	}
-	var task Task
-	var taskID uuid.UUID // Объявление переменной taskID типа uuid.UUID
-	id := c.Param("id")
-	taskID, err := uuid.Parse(id) // Преобразование строки id в тип uuid.UUID
-
-	if err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "toggleStarTask",
-			"error":  err.Error(),
-		}).Error("Error parsing task ID")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат идентификатора задачи"})
-		return
-	}
-
-	if err := db.First(&task, "id = ?", taskID).Error; err != nil {
-		log.WithFields(logrus.Fields{
-			"action": "toggleStarTask",
-			"error":  err.Error(),
-		}).Error("Error retrieving task for toggle star")
-		c.JSON(http.StatusNotFound, gin.H{"error": "Задача не найдена"})
+	task, principal, ok := findUserTask(c, "toggleStarTask", db)
+	if !ok {
 		return
 	}
 
+	before := snapshotOf(&task)
 	task.ToggleHaveStar()
 
-	if err := db.Save(&task).Error; err != nil {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := saveTaskVersioned(tx, &task); err != nil {
+			return err
+		}
+		return recordRevision(tx, &task, &before, principal.UserId, "star", nil)
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondVersionConflict(c, &task, http.StatusConflict)
+		return
+	}
+	if err != nil {
 		log.WithFields(logrus.Fields{
 			"action": "toggleStarTask",
 			"error":  err.Error(),
@@ -787,5 +1111,73 @@ func ToggleStarTask(c *gin.Context) {
 		"lastUpdated": task.LastUpdated,
 	}).Info("Task star status toggled successfully")
 
-	c.JSON(http.StatusOK, gin.H{"haveStar": task.HaveStar, "lastUpdated": task.LastUpdated})
+	c.Header("ETag", taskETag(&task))
+	c.JSON(http.StatusOK, gin.H{"haveStar": task.HaveStar, "priority": task.Priority, "lastUpdated": task.LastUpdated, "version": task.Version})
+}
+
+func CompleteTask(c *gin.Context) {
+	setTaskCompletion(c, "completeTask", true)
+}
+
+func ReopenTask(c *gin.Context) {
+	setTaskCompletion(c, "reopenTask", false)
+}
+
+func setTaskCompletion(c *gin.Context, action string, completed bool) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, principal, ok := findUserTask(c, action, db)
+	if !ok {
+		return
+	}
+
+	before := snapshotOf(&task)
+	var nextTask *Task
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !completed {
+			task.Reopen()
+			if err := saveTaskVersioned(tx, &task); err != nil {
+				return err
+			}
+			return recordRevision(tx, &task, &before, principal.UserId, "reopen", nil)
+		}
+		task.Complete()
+		if err := saveTaskVersioned(tx, &task); err != nil {
+			return err
+		}
+		if err := recordRevision(tx, &task, &before, principal.UserId, "complete", nil); err != nil {
+			return err
+		}
+		var err error
+		nextTask, err = spawnNextOccurrence(tx, &task)
+		return err
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondVersionConflict(c, &task, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error updating task completion")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":      action,
+		"taskID":      task.ID,
+		"completed":   task.Completed,
+		"completedAt": task.CompletedAt,
+	}).Info("Task completion status changed successfully")
+
+	response := gin.H{"completed": task.Completed, "completedAt": task.CompletedAt, "lastUpdated": task.LastUpdated, "version": task.Version}
+	if nextTask != nil {
+		response["nextTask"] = nextTask
+	}
+	c.Header("ETag", taskETag(&task))
+	c.JSON(http.StatusOK, response)
 }
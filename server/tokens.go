@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiTokenPrefix отличает персональные токены от JWT в заголовке Authorization
+// и помогает сканерам секретов находить утёкшие токены.
+const apiTokenPrefix = "tdo_"
+
+const (
+	scopeTasksRead  = "tasks:read"
+	scopeTasksWrite = "tasks:write"
+	scopeAdmin      = "admin"
+)
+
+var apiTokenScopes = []string{scopeAdmin, scopeTasksRead, scopeTasksWrite}
+
+// apiTokenLastUsedInterval ограничивает частоту записи last_used_at
+const apiTokenLastUsedInterval = time.Minute
+
+var (
+	errScopeRequired   = errors.New("Token does not have the required scope")
+	errSessionRequired = errors.New("This endpoint requires a user session")
+)
+
+// ApiToken — персональный токен доступа для скриптов и интеграций.
+// Хранится только хэш; сам токен показывается один раз при создании.
+type ApiToken struct {
+	ID          uuid.UUID  `gorm:"primaryKey" json:"id"`
+	UserId      uint       `json:"-" gorm:"index"`
+	Name        string     `json:"name"`
+	Scopes      string     `json:"-"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex"`
+	Prefix      string     `json:"prefix"`
+	CreatedDate time.Time  `json:"createdDate"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	LastUsedAt  *time.Time `json:"lastUsedAt"`
+}
+
+type ApiTokenResponse struct {
+	ApiToken
+	Scopes []string `json:"scopes"`
+	// Token заполняется только в ответе на создание
+	Token string `json:"token,omitempty"`
+}
+
+type CreateApiTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func (t *ApiToken) scopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+func (t *ApiToken) response() ApiTokenResponse {
+	return ApiTokenResponse{ApiToken: *t, Scopes: t.scopeList()}
+}
+
+// HasScope сообщает, может ли principal действовать с этим scope. У входа через
+// пользовательскую сессию есть все scope, которые разрешает его роль.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return scope != scopeAdmin || p.IsAdmin()
+	}
+	for _, granted := range p.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateBearer принимает в схеме Bearer и JWT, и персональные токены
+func authenticateBearer(credentials string) (*Principal, error) {
+	if strings.HasPrefix(credentials, apiTokenPrefix) {
+		return authenticateAPIToken(credentials)
+	}
+	return authenticateJWT(credentials)
+}
+
+func authenticateAPIToken(credentials string) (*Principal, error) {
+	if !strings.HasPrefix(credentials, apiTokenPrefix) {
+		return nil, errInvalidToken
+	}
+	now := time.Now()
+	var token ApiToken
+	if err := db.Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", hashToken(credentials), now).
+		First(&token).Error; err != nil {
+		return nil, errInvalidToken
+	}
+	var user User
+	if err := db.First(&user, token.UserId).Error; err != nil {
+		return nil, errInvalidToken
+	}
+	db.Model(&ApiToken{}).Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", token.ID, now.Add(-apiTokenLastUsedInterval)).
+		Update("last_used_at", now)
+
+	scopes := token.scopeList()
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return &Principal{
+		UserId:      user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		IsActivated: user.IsActivated,
+		Role:        user.ROLE,
+		Scopes:      scopes,
+		TokenID:     token.ID,
+	}, nil
+}
+
+// accountRoutes — маршруты управления учётной записью. Они доступны только
+// из пользовательской сессии, чтобы утёкший токен не позволял сменить пароль,
+// отключить 2FA или выпустить новые токены.
+var accountRoutes = []string{"/logout", "/logout-all", "/resend-activation-link", "/api/user/", "/api/tokens"}
+
+// requiredScope определяет право, нужное для маршрута: чтение задач для GET,
+// запись для остальных методов и admin для административных маршрутов.
+// Пустая строка означает маршрут учётной записи.
+func requiredScope(c *gin.Context) string {
+	path := c.FullPath()
+	for _, prefix := range accountRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return ""
+		}
+	}
+	if strings.HasPrefix(path, "/api/admin/") {
+		return scopeAdmin
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		return scopeTasksRead
+	}
+	return scopeTasksWrite
+}
+
+func authorizeScope(c *gin.Context, principal *Principal) error {
+	if principal.Scopes == nil {
+		return nil
+	}
+	scope := requiredScope(c)
+	if scope == "" {
+		return errSessionRequired
+	}
+	if !principal.HasScope(scope) {
+		return errScopeRequired
+	}
+	return nil
+}
+
+func GetApiTokens(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	var tokens []ApiToken
+	if err := db.Where("user_id = ?", principal.UserId).Order("created_date DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tokens"})
+		return
+	}
+	response := make([]ApiTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = tokens[i].response()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func CreateApiToken(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	var request CreateApiTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	if len(request.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required", "allowed": apiTokenScopes})
+		return
+	}
+	seen := map[string]bool{}
+	var scopes []string
+	for _, scope := range request.Scopes {
+		known := false
+		for _, candidate := range apiTokenScopes {
+			known = known || candidate == scope
+		}
+		if !known {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown scope %q", scope), "allowed": apiTokenScopes})
+			return
+		}
+		if scope == scopeAdmin && !principal.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can create tokens with the admin scope"})
+			return
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiration must be in the future"})
+		return
+	}
+
+	secret, err := newSecretToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	plain := apiTokenPrefix + secret
+	token := ApiToken{
+		ID:          uuid.New(),
+		UserId:      principal.UserId,
+		Name:        request.Name,
+		Scopes:      strings.Join(scopes, " "),
+		TokenHash:   hashToken(plain),
+		Prefix:      plain[:len(apiTokenPrefix)+6],
+		CreatedDate: time.Now(),
+		ExpiresAt:   request.ExpiresAt,
+	}
+	if err := db.Create(&token).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createApiToken",
+			"error":  err.Error(),
+		}).Error("Error creating API token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":  "createApiToken",
+		"userId":  principal.UserId,
+		"tokenId": token.ID,
+		"scopes":  token.Scopes,
+	}).Info("API token created")
+
+	response := token.response()
+	response.Token = plain
+	c.JSON(http.StatusCreated, response)
+}
+
+func DeleteApiToken(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	tokenID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+	result := db.Where("id = ? AND user_id = ?", tokenID, principal.UserId).Delete(&ApiToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":  "deleteApiToken",
+		"userId":  principal.UserId,
+		"tokenId": tokenID,
+	}).Info("API token deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token deleted"})
+}
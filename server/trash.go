@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultTrashRetentionDays = 30
+
+// trashedSubtreeCTE обходит подзадачи, которые находятся в корзине
+const trashedSubtreeCTE = `WITH RECURSIVE subtree AS (
+	SELECT id, deleted_at FROM tasks WHERE parent_id = ? AND deleted_at IS NOT NULL
+	UNION
+	SELECT tasks.id, tasks.deleted_at FROM tasks JOIN subtree ON tasks.parent_id = subtree.id WHERE tasks.deleted_at IS NOT NULL
+)`
+
+// trashedTasks — задачи пользователя в корзине
+func trashedTasks(tx *gorm.DB, userId uint) *gorm.DB {
+	return tx.Unscoped().Model(&Task{}).Scopes(taskScope(userId)).Where("tasks.deleted_at IS NOT NULL")
+}
+
+// purgeTasks удаляет задачи окончательно вместе с тегами, напоминаниями и историей
+func purgeTasks(tx *gorm.DB, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM task_tags WHERE task_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("task_id IN ?", ids).Delete(&Reminder{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("task_id IN ?", ids).Delete(&TaskRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Model(&Task{}).Where("next_occurrence_id IN ?", ids).Update("next_occurrence_id", nil).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&Task{}).Error
+}
+
+// restoreTaskTree возвращает задачу из корзины вместе с подзадачами, удалёнными
+// тем же запросом. Если родитель всё ещё в корзине или удалён, задача становится
+// корневой; если удалён проект — попадает во «Входящие».
+func restoreTaskTree(tx *gorm.DB, task *Task) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := tx.Raw(trashedSubtreeCTE+" SELECT id FROM subtree WHERE deleted_at = ?", task.ID, task.DeletedAt.Time).Scan(&ids).Error
+	if err != nil {
+		return nil, err
+	}
+	ids = append(ids, task.ID)
+
+	now := time.Now()
+	if err := tx.Unscoped().Model(&Task{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"deleted_at": nil, "lastupdated": now, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return nil, err
+	}
+	if task.ParentID != nil {
+		var count int64
+		if err := tx.Model(&Task{}).Where("id = ?", *task.ParentID).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			if err := tx.Model(&Task{}).Where("id = ?", task.ID).
+				Updates(map[string]interface{}{"parent_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Model(&Task{}).Where("id IN ? AND project_id IS NOT NULL AND project_id NOT IN (?)", ids, tx.Model(&Project{}).Select("id")).
+		Updates(map[string]interface{}{"project_id": nil, "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return nil, err
+	}
+	// Пропущенные за время в корзине напоминания уже не актуальны
+	if err := tx.Model(&Reminder{}).Where("task_id IN ? AND status = ? AND remind_at < ?", ids, reminderPending, now).
+		Update("status", reminderCancelled).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// trashedTreeIDs возвращает задачу и все её подзадачи из корзины
+func trashedTreeIDs(tx *gorm.DB, taskID uuid.UUID) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	if err := tx.Raw(trashedSubtreeCTE+" SELECT id FROM subtree", taskID).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return append(ids, taskID), nil
+}
+
+func GetTrash(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > maxTaskPageSize {
+		pageSize = 10
+	}
+
+	var total int64
+	if err := trashedTasks(db, principal.UserId).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения корзины"})
+		return
+	}
+	var tasks []Task
+	err := trashedTasks(db, principal.UserId).Preload("Tags").Order("deleted_at DESC, id").
+		Offset((page - 1) * pageSize).Limit(pageSize).Find(&tasks).Error
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "getTrash",
+			"error":  err.Error(),
+		}).Error("Error retrieving trash")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения корзины"})
+		return
+	}
+	if tasks == nil {
+		tasks = []Task{}
+	}
+
+	response := TaskPage{
+		Items:      tasks,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	}
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, response)
+}
+
+func RestoreTask(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, _, ok := findUserTask(c, "restoreTask", db.Unscoped().Where("tasks.deleted_at IS NOT NULL"))
+	if !ok {
+		return
+	}
+
+	var ids []uuid.UUID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		ids, err = restoreTaskTree(tx, &task)
+		return err
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "restoreTask",
+			"error":  err.Error(),
+		}).Error("Error restoring task from trash")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка восстановления задачи"})
+		return
+	}
+
+	var restored Task
+	if err := db.Preload("Tags").First(&restored, "id = ?", task.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка восстановления задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":   "restoreTask",
+		"taskID":   task.ID,
+		"restored": len(ids),
+	}).Info("Task restored from trash successfully")
+
+	c.JSON(http.StatusOK, gin.H{"task": restored, "restored": len(ids)})
+}
+
+func PurgeTask(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	task, _, ok := findUserTask(c, "purgeTask", db.Unscoped().Where("tasks.deleted_at IS NOT NULL"))
+	if !ok {
+		return
+	}
+
+	var ids []uuid.UUID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if ids, err = trashedTreeIDs(tx, task.ID); err != nil {
+			return err
+		}
+		return purgeTasks(tx, ids)
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "purgeTask",
+			"error":  err.Error(),
+		}).Error("Error purging task")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления задачи"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "purgeTask",
+		"taskID": task.ID,
+		"purged": len(ids),
+	}).Info("Task purged successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Задача удалена окончательно", "purged": len(ids)})
+}
+
+func EmptyTrash(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var ids []uuid.UUID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := trashedTasks(tx, principal.UserId).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		return purgeTasks(tx, ids)
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "emptyTrash",
+			"error":  err.Error(),
+		}).Error("Error emptying trash")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка очистки корзины"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "emptyTrash",
+		"userId": principal.UserId,
+		"purged": len(ids),
+	}).Info("Trash emptied successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Корзина очищена", "purged": len(ids)})
+}
+
+// trashRetention читает TRASH_RETENTION_DAYS; 0 отключает автоматическую очистку
+func trashRetention() (time.Duration, error) {
+	days := defaultTrashRetentionDays
+	if value := os.Getenv("TRASH_RETENTION_DAYS"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 0 {
+			return 0, fmt.Errorf("TRASH_RETENTION_DAYS must be a non-negative number of days, got %q", value)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// TrashPurger окончательно удаляет задачи, пролежавшие в корзине дольше срока
+// хранения. Очистка идемпотентна, поэтому реплики могут запускать её одновременно.
+type TrashPurger struct {
+	clock     Clock
+	retention time.Duration
+	interval  time.Duration
+	batchSize int
+}
+
+func NewTrashPurger(clock Clock, retention time.Duration) *TrashPurger {
+	return &TrashPurger{
+		clock:     clock,
+		retention: retention,
+		interval:  time.Hour,
+		batchSize: 500,
+	}
+}
+
+func (p *TrashPurger) Start(ctx context.Context) {
+	runPeriodically(ctx, p.interval, func(ctx context.Context) {
+		if purged, err := p.RunOnce(ctx); err != nil {
+			log.WithFields(logrus.Fields{
+				"action": "trashPurger",
+				"error":  err.Error(),
+			}).Error("Error purging trash")
+		} else if purged > 0 {
+			log.WithFields(logrus.Fields{
+				"action": "trashPurger",
+				"purged": purged,
+			}).Info("Expired trash purged")
+		}
+	})
+}
+
+// RunOnce очищает задачи, удалённые раньше срока хранения, и возвращает их число
+func (p *TrashPurger) RunOnce(ctx context.Context) (int, error) {
+	cutoff := p.clock.Now().Add(-p.retention)
+	purged := 0
+	for ctx.Err() == nil {
+		var ids []uuid.UUID
+		err := db.WithContext(ctx).Unscoped().Model(&Task{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Limit(p.batchSize).Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return purged, err
+		}
+		if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error { return purgeTasks(tx, ids) }); err != nil {
+			return purged, err
+		}
+		purged += len(ids)
+	}
+	return purged, ctx.Err()
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Параметры TOTP (RFC 6238) — значения по умолчанию, которые понимают все приложения-аутентификаторы
+const (
+	totpIssuer = "Todo App"
+	totpDigits = 6
+	totpPeriod = 30
+	// totpSkew — сколько соседних интервалов принимается из-за расхождения часов
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+
+	twoFactorChallengeExpiresIn = 5 * time.Minute
+	// Лимит неудачных попыток ввода кода для пользователя за twoFactorLockWindow
+	maxTwoFactorAttempts = 10
+	twoFactorLockWindow  = 15 * time.Minute
+)
+
+var (
+	errInvalidTwoFactorCode = errors.New("Invalid two-factor code")
+	errTooManyAttempts      = errors.New("Too many attempts, try again later")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// RecoveryCode — одноразовый код восстановления на случай потери устройства.
+// Коды хранятся как bcrypt-хэши.
+type RecoveryCode struct {
+	ID          uuid.UUID `gorm:"primaryKey"`
+	UserId      uint      `gorm:"index"`
+	CodeHash    string
+	CreatedDate time.Time
+	UsedAt      *time.Time
+}
+
+// TwoFactorChallenge — второй шаг входа: пароль уже проверен, ожидается код.
+type TwoFactorChallenge struct {
+	ID          uuid.UUID `gorm:"primaryKey"`
+	UserId      uint      `gorm:"index"`
+	TokenHash   string    `gorm:"uniqueIndex"`
+	Attempts    int
+	CreatedDate time.Time
+	ExpiresAt   time.Time
+	UsedAt      *time.Time
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password     string `json:"password"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// totpCode вычисляет значение HOTP (RFC 4226) для одного шага времени.
+func totpCode(secret []byte, step int64) string {
+	mac := hmac.New(sha1.New, secret)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// verifyTOTP возвращает шаг времени, которому соответствует код. Шаги до lastStep
+// включительно отклоняются, чтобы перехваченный код нельзя было повторить.
+func verifyTOTP(secret string, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	code = strings.ReplaceAll(code, " ", "")
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func newTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+func totpURI(user *User, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + user.Email)
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", totpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// replaceRecoveryCodes удаляет старые коды восстановления и создаёт новые.
+// Открытые значения возвращаются пользователю один раз.
+func replaceRecoveryCodes(tx *gorm.DB, userId uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	now := time.Now()
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes[i] = raw[:4] + "-" + raw[4:]
+		hash, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Create(&RecoveryCode{ID: uuid.New(), UserId: userId, CodeHash: string(hash), CreatedDate: now}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// useRecoveryCode погашает подходящий неиспользованный код восстановления
+func useRecoveryCode(tx *gorm.DB, userId uint, code string) (bool, error) {
+	var codes []RecoveryCode
+	if err := tx.Where("user_id = ? AND used_at IS NULL", userId).Find(&codes).Error; err != nil {
+		return false, err
+	}
+	code = normalizeRecoveryCode(code)
+	for _, candidate := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(candidate.CodeHash), []byte(code)) != nil {
+			continue
+		}
+		result := tx.Model(&RecoveryCode{}).Where("id = ? AND used_at IS NULL", candidate.ID).Update("used_at", time.Now())
+		return result.RowsAffected == 1, result.Error
+	}
+	return false, nil
+}
+
+// checkSecondFactor проверяет TOTP-код или код восстановления пользователя с
+// включённой 2FA и запоминает использованный интервал TOTP.
+func checkSecondFactor(tx *gorm.DB, user *User, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		ok, err := useRecoveryCode(tx, user.ID, recoveryCode)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		return nil
+	}
+	step, ok := verifyTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+	// Условие на последний интервал не даёт принять один код дважды
+	result := tx.Model(&User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+// startTwoFactorChallenge выдаёт токен второго шага входа
+func startTwoFactorChallenge(user *User) (string, error) {
+	token, err := newSecretToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = db.Create(&TwoFactorChallenge{
+		ID:          uuid.New(),
+		UserId:      user.ID,
+		TokenHash:   hashToken(token),
+		CreatedDate: now,
+		ExpiresAt:   now.Add(twoFactorChallengeExpiresIn),
+	}).Error
+	return token, err
+}
+
+func loadCurrentUser(c *gin.Context) (*User, bool) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return nil, false
+	}
+	var user User
+	if err := db.First(&user, principal.UserId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// LoginTwoFactor завершает вход пользователя с 2FA: принимает токен,
+// выданный Login, и TOTP-код или код восстановления.
+func LoginTwoFactor(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var request TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.ChallengeToken == "" || (request.Code == "") == (request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	now := time.Now()
+	var challenge TwoFactorChallenge
+	if err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(request.ChallengeToken), now).
+		First(&challenge).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+
+	// Попытка засчитывается до проверки кода, а лимит проверяется по сумме уже
+	// с ней: если сначала читать счётчик и увеличивать его после проверки,
+	// параллельные запросы проходят проверку лимита разом.
+	result := db.Model(&TwoFactorChallenge{}).Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+		return
+	}
+	// Неудачные попытки считаются по всем недавним входам, иначе код можно
+	// было бы перебирать, каждый раз начиная вход заново
+	var attempts int64
+	if err := db.Model(&TwoFactorChallenge{}).Where("user_id = ? AND created_date > ?", challenge.UserId, now.Add(-twoFactorLockWindow)).
+		Select("COALESCE(SUM(attempts), 0)").Scan(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if attempts > maxTwoFactorAttempts {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": errTooManyAttempts.Error()})
+		return
+	}
+
+	var user User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, challenge.UserId).Error; err != nil {
+			return err
+		}
+		if !user.TOTPEnabled {
+			return errInvalidTwoFactorCode
+		}
+		if err := checkSecondFactor(tx, &user, request.Code, request.RecoveryCode); err != nil {
+			return err
+		}
+		// Удачная попытка не должна приближать блокировку
+		result := tx.Model(&TwoFactorChallenge{}).Where("id = ? AND used_at IS NULL", challenge.ID).
+			Updates(map[string]interface{}{"used_at": now, "attempts": gorm.Expr("attempts - 1")})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errInvalidTwoFactorCode
+		}
+		return result.Error
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		log.WithFields(logrus.Fields{
+			"action": "loginTwoFactor",
+			"userId": challenge.UserId,
+		}).Warn("Invalid two-factor code")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+
+	tokens, err := issueTokens(c, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// SetupTwoFactor создаёт новый секрет TOTP. 2FA включается только после
+// подтверждения кодом из приложения в EnableTwoFactor.
+func SetupTwoFactor(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+	if err := db.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauthUri": totpURI(user, secret)})
+}
+
+// EnableTwoFactor включает 2FA после проверки первого кода и возвращает коды восстановления.
+func EnableTwoFactor(c *gin.Context) {
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	var request TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Call POST /api/user/2fa/setup first"})
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, user, request.Code, ""); err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("totp_enabled", true).Error; err != nil {
+			return err
+		}
+		var err error
+		if codes, err = replaceRecoveryCodes(tx, user.ID); err != nil {
+			return err
+		}
+		// Остальные устройства входили без второго фактора
+		_, err = revokeUserSessions(tx, user.ID, principal.SessionID)
+		return err
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "enableTwoFactor",
+			"error":  err.Error(),
+		}).Error("Error enabling two-factor authentication")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "enableTwoFactor",
+		"userId": user.ID,
+	}).Info("Two-factor authentication enabled")
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления; старые перестают действовать.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	var request TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, user, request.Code, ""); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// disableTwoFactor удаляет секрет и коды восстановления пользователя
+func disableTwoFactor(tx *gorm.DB, userId uint) error {
+	if err := tx.Model(&User{}).Where("id = ?", userId).
+		Updates(map[string]interface{}{"totp_enabled": false, "totp_secret": "", "totp_last_step": 0}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userId).Delete(&RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&TwoFactorChallenge{}).Where("user_id = ? AND used_at IS NULL", userId).Update("used_at", time.Now()).Error
+}
+
+// DisableTwoFactor отключает 2FA; требуется пароль и действующий код.
+func DisableTwoFactor(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	var request DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Code == "") == (request.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkSecondFactor(tx, user, request.Code, request.RecoveryCode); err != nil {
+			return err
+		}
+		return disableTwoFactor(tx, user.ID)
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "disableTwoFactor",
+		"userId": user.ID,
+	}).Info("Two-factor authentication disabled")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// ResetUserTwoFactor — сброс 2FA администратором для пользователя, потерявшего
+// устройство и коды восстановления. Сессии пользователя завершаются.
+func ResetUserTwoFactor(c *gin.Context) {
+	admin, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	userId, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	var user User
+	if err := db.First(&user, userId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := disableTwoFactor(tx, user.ID); err != nil {
+			return err
+		}
+		_, err := revokeUserSessions(tx, user.ID, uuid.Nil)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset two-factor authentication"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action":  "resetUserTwoFactor",
+		"userId":  user.ID,
+		"adminId": admin.UserId,
+	}).Info("Two-factor authentication reset by admin")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// Параллельные попытки не обходят лимит: каждая засчитывается до проверки кода
+func TestLoginTwoFactorLimitsConcurrentAttempts(t *testing.T) {
+	setupTestDB(t)
+	router := newRouter()
+	user := createTestUser(t, "alice")
+	secret, err := newTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(user).Updates(map[string]interface{}{"totp_secret": secret, "totp_enabled": true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, err := startTwoFactorChallenge(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 3 * maxTwoFactorAttempts
+	codes := make([]int, requests)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"challengeToken":%q,"code":"not-a-code"}`, token)
+			codes[i] = performRequest(router, http.MethodPost, "/login/2fa", body, "").Code
+		}(i)
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusUnauthorized:
+			checked++
+		case http.StatusTooManyRequests:
+		default:
+			t.Fatalf("unexpected status %d", code)
+		}
+	}
+	if checked > maxTwoFactorAttempts {
+		t.Fatalf("%d codes were checked, want at most %d", checked, maxTwoFactorAttempts)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SavedView — сохранённый запрос (умный список). Query — выражение языка
+// запросов задач, Sort — сортировка в формате параметра sort.
+type SavedView struct {
+	ID          uuid.UUID `gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex:idx_saved_views_user_name"`
+	Query       string    `json:"query"`
+	Sort        string    `json:"sort"`
+	UserId      uint      `json:"userId" gorm:"uniqueIndex:idx_saved_views_user_name"`
+	CreatedDate time.Time `json:"createdDate"`
+	LastUpdated time.Time `json:"lastUpdated" gorm:"column:lastupdated"`
+}
+
+type savedViewRequest struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	Sort  string `json:"sort"`
+}
+
+// validate проверяет имя и один раз компилирует query и sort, чтобы сломанный
+// вид отклонялся сразу с позицией ошибки парсера, а не падал позже.
+func (r *savedViewRequest) validate(c *gin.Context, userId uint, exceptID uuid.UUID) bool {
+	r.Name = strings.TrimSpace(r.Name)
+	if r.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Название представления обязательно"})
+		return false
+	}
+	if _, err := parseTaskQuery(r.Query, userId, time.Now(), userLocation(userId)); err != nil {
+		respondQueryError(c, err)
+		return false
+	}
+	if _, err := parseTaskSort(r.Sort, "", ""); err != nil {
+		respondQueryError(c, err)
+		return false
+	}
+
+	var count int64
+	db.Model(&SavedView{}).Where("user_id = ? AND name = ? AND id <> ?", userId, r.Name, exceptID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Представление с таким названием уже существует"})
+		return false
+	}
+	return true
+}
+
+func findUserView(c *gin.Context, action string) (SavedView, bool) {
+	var view SavedView
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return view, false
+	}
+
+	viewID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error parsing view ID")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный идентификатор представления"})
+		return view, false
+	}
+
+	if err := db.First(&view, "id = ? AND user_id = ?", viewID, principal.UserId).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": action,
+			"error":  err.Error(),
+		}).Error("Error retrieving view")
+		c.JSON(http.StatusNotFound, gin.H{"error": "Представление не найдено"})
+		return view, false
+	}
+	return view, true
+}
+
+func GetViews(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var views []SavedView
+	if err := db.Where("user_id = ?", principal.UserId).Order("name").Find(&views).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения представлений"})
+		return
+	}
+
+	c.JSON(http.StatusOK, views)
+}
+
+func GetView(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	view, ok := findUserView(c, "getView")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+func CreateView(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	var request savedViewRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createView",
+			"error":  err.Error(),
+		}).Error("Error binding JSON for creating view")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+
+	principal, ok := currentPrincipal(c)
+	if !ok {
+		return
+	}
+	if !request.validate(c, principal.UserId, uuid.Nil) {
+		return
+	}
+
+	now := time.Now()
+	view := SavedView{
+		ID:          uuid.New(),
+		Name:        request.Name,
+		Query:       request.Query,
+		Sort:        request.Sort,
+		UserId:      principal.UserId,
+		CreatedDate: now,
+		LastUpdated: now,
+	}
+	if err := db.Create(&view).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "createView",
+			"error":  err.Error(),
+		}).Error("Error creating view in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания представления"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "createView",
+		"viewID": view.ID,
+	}).Info("View created successfully")
+
+	c.JSON(http.StatusCreated, view)
+}
+
+func UpdateView(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	view, ok := findUserView(c, "updateView")
+	if !ok {
+		return
+	}
+
+	var request savedViewRequest
+	if err := c.BindJSON(&request); err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "updateView",
+			"error":  err.Error(),
+		}).Error("Error binding JSON for updating view")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка входных данных"})
+		return
+	}
+	if !request.validate(c, view.UserId, view.ID) {
+		return
+	}
+
+	view.Name = request.Name
+	view.Query = request.Query
+	view.Sort = request.Sort
+	view.LastUpdated = time.Now()
+
+	if err := db.Save(&view).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "updateView",
+			"error":  err.Error(),
+		}).Error("Error updating view in the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления представления"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "updateView",
+		"viewID": view.ID,
+	}).Info("View updated successfully")
+
+	c.JSON(http.StatusOK, view)
+}
+
+func DeleteView(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	view, ok := findUserView(c, "deleteView")
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(&view).Error; err != nil {
+		log.WithFields(logrus.Fields{
+			"action": "deleteView",
+			"error":  err.Error(),
+		}).Error("Error deleting view from the database")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления представления"})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"action": "deleteView",
+		"viewID": view.ID,
+	}).Info("View deleted successfully")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Представление успешно удалено"})
+}
+
+// GetViewTasks выполняет сохранённый запрос как папку: поддерживает те же
+// параметры страниц и фильтры, что и GET /api/tasks. Параметр sort заменяет
+// сортировку представления.
+func GetViewTasks(c *gin.Context) {
+	checkLimiter(c)
+	if c.IsAborted() {
+		return
+	}
+	view, ok := findUserView(c, "getViewTasks")
+	if !ok {
+		return
+	}
+
+	sort := view.Sort
+	if c.Query("sort") != "" {
+		sort = c.Query("sort")
+	}
+	listTasks(c, "getViewTasks", view.Query, sort)
+}